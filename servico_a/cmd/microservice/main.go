@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"servico_a/internal/breaker"
+	"servico_a/internal/httpclient"
+	"servico_a/internal/identity"
+	"servico_a/internal/logging"
+	"servico_a/internal/metrics"
 	"servico_a/internal/web"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -15,15 +22,24 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 
+	"go.opentelemetry.io/contrib/bridges/otelslog"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/log/global"
 	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
-func initProvider(serviceName, collectorURL string) (func(context.Context) error, error) {
+// initProvider sets up the tracer, meter and logger providers exporting to
+// the collector, the meter provider also read by readers, such as the
+// Prometheus one
+func initProvider(serviceName, collectorURL string, readers ...sdkmetric.Reader) (func(context.Context) error, error) {
 	ctx := context.Background()
 
 	res, err := resource.New(ctx,
@@ -58,57 +74,185 @@ func initProvider(serviceName, collectorURL string) (func(context.Context) error
 	)
 	otel.SetTracerProvider(tracerProvider)
 
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	metricExporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithGRPCConn(conn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+	}
+	options := []sdkmetric.Option{
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter,
+			sdkmetric.WithInterval(viper.GetDuration("OTEL_METRIC_EXPORT_INTERVAL")))),
+	}
+	for _, reader := range readers {
+		options = append(options, sdkmetric.WithReader(reader))
+	}
+	meterProvider := sdkmetric.NewMeterProvider(options...)
+	otel.SetMeterProvider(meterProvider)
+	if err := metrics.StartRuntime(meterProvider); err != nil {
+		return nil, fmt.Errorf("failed to start runtime metrics: %w", err)
+	}
+
+	logExporter, err := otlploggrpc.New(ctx, otlploggrpc.WithGRPCConn(conn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log exporter: %w", err)
+	}
+	loggerProvider := sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)),
+	)
+	global.SetLoggerProvider(loggerProvider)
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
 
-	return tracerProvider.Shutdown, nil
+	return func(ctx context.Context) error {
+		return errors.Join(tracerProvider.Shutdown(ctx), meterProvider.Shutdown(ctx), loggerProvider.Shutdown(ctx))
+	}, nil
 }
 
 // load env vars cfg
 func init() {
 	viper.AutomaticEnv()
+	viper.SetDefault("BATCH_CONCURRENCY", 10)
+	viper.SetDefault("BATCH_MAX_SIZE", 1000)
+	viper.SetDefault("BREAKER_FAILURE_THRESHOLD", breaker.DefaultFailureThreshold)
+	viper.SetDefault("BREAKER_OPEN_TIMEOUT", breaker.DefaultOpenTimeout)
+	viper.SetDefault("OTEL_METRIC_EXPORT_INTERVAL", 15*time.Second)
+	viper.SetDefault("METRICS_ENABLED", true)
+	viper.SetDefault("REQUEST_CHANNELS", strings.Join(identity.DefaultChannels, ","))
+	viper.SetDefault("LOG_FORMAT", logging.FormatJSON)
+	viper.SetDefault("LOG_LEVEL", "info")
+}
+
+// newLogger builds the logger set up in LOG_FORMAT and LOG_LEVEL, handing the
+// records to bridge too when set
+func newLogger(bridge slog.Handler) (*slog.Logger, error) {
+	level, err := logging.ParseLevel(viper.GetString("LOG_LEVEL"))
+	if err != nil {
+		return nil, err
+	}
+	return logging.New(os.Stderr, logging.Options{
+		Format: viper.GetString("LOG_FORMAT"),
+		Level:  level,
+		Bridge: bridge,
+	})
+}
+
+// fatal logs err as the reason the service stops, and stops it
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// serveMetrics returns the handler of /metrics for the main router, nil when
+// the metrics are off or METRICS_PORT gives them a port of their own, the
+// admin one, kept apart from the public API
+func serveMetrics(handler http.Handler) http.Handler {
+	port := viper.GetString("METRICS_PORT")
+	if handler == nil || port == "" {
+		return handler
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	go func() {
+		slog.Info("starting metrics server", "port", port)
+		if err := http.ListenAndServe(port, mux); err != nil {
+			fatal("metrics server stopped", err)
+		}
+	}()
+	return nil
 }
 
 func main() {
+	logger, err := newLogger(nil)
+	if err != nil {
+		fatal("failed to set up logging", err)
+	}
+	slog.SetDefault(logger)
+
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	shutdown, err := initProvider(viper.GetString("OTEL_SERVICE_NAME"), viper.GetString("OTEL_EXPORTER_OTLP_ENDPOINT"))
+	var readers []sdkmetric.Reader
+	var metricsHandler http.Handler
+	if viper.GetBool("METRICS_ENABLED") {
+		reader, handler, err := metrics.NewPrometheus()
+		if err != nil {
+			fatal("failed to start", err)
+		}
+		readers, metricsHandler = append(readers, reader), handler
+	}
+
+	shutdown, err := initProvider(viper.GetString("OTEL_SERVICE_NAME"), viper.GetString("OTEL_EXPORTER_OTLP_ENDPOINT"), readers...)
 	if err != nil {
-		log.Fatal(err)
+		fatal("failed to set up telemetry", err)
 	}
+	// a partir daqui os logs seguem também para o coletor, com o trace de cada
+	// requisição
+	logger, err = newLogger(otelslog.NewHandler("microservice-logger"))
+	if err != nil {
+		fatal("failed to set up logging", err)
+	}
+	slog.SetDefault(logger)
 	defer func() {
 		if err := shutdown(ctx); err != nil {
-			log.Fatal("failed to shutdown TracerProvider: %w", err)
+			slog.Error("failed to shutdown the telemetry providers", "error", err)
 		}
 	}()
 
 	tracer := otel.Tracer("microservice-tracer")
+	meter := otel.Meter("microservice-meter")
+	measurements, err := metrics.New(meter)
+	if err != nil {
+		fatal("failed to start", err)
+	}
+
+	serviceB, err := breaker.New("servico_b", breaker.Settings{
+		FailureThreshold: viper.GetInt("BREAKER_FAILURE_THRESHOLD"),
+		OpenTimeout:      viper.GetDuration("BREAKER_OPEN_TIMEOUT"),
+	}, meter)
+	if err != nil {
+		fatal("failed to start", err)
+	}
+
+	clients, err := identity.ParseClients(viper.GetString("CLIENT_API_KEYS"))
+	if err != nil {
+		fatal("failed to start", err)
+	}
 
 	serviceData := &web.ServiceData{
 		Title:              viper.GetString("TITLE"),
 		ExternalCallURL:    viper.GetString("EXTERNAL_CALL_URL"),
 		ExternalCallMethod: viper.GetString("EXTERNAL_CALL_METHOD"),
+		BatchConcurrency:   viper.GetInt("BATCH_CONCURRENCY"),
+		BatchMaxSize:       viper.GetInt("BATCH_MAX_SIZE"),
+		Breaker:            serviceB,
+		Client:             httpclient.New(),
 		RequestNameOTEL:    viper.GetString("REQUEST_NAME_OTEL"),
 		OTELTracer:         tracer,
+		CepHashKey:         []byte(viper.GetString("CEP_HASH_KEY")),
+		Clients:            clients,
+		Channels:           strings.Split(viper.GetString("REQUEST_CHANNELS"), ","),
+		Metrics:            measurements,
+		MetricsHandler:     serveMetrics(metricsHandler),
 	}
 	server := web.NewServer(serviceData)
 	router := server.CreateServer()
 
 	go func() {
-		log.Println("Starting server on port", viper.GetString("HTTP_PORT"))
+		slog.Info("starting server", "port", viper.GetString("HTTP_PORT"))
 		if err := http.ListenAndServe(viper.GetString("HTTP_PORT"), router); err != nil {
-			log.Fatal(err)
+			fatal("server stopped", err)
 		}
 	}()
 
 	select {
 	case <-sigCh:
-		log.Println("Shutting down gracefully, CTRL+C pressed...")
+		slog.Info("shutting down gracefully, CTRL+C pressed")
 	case <-ctx.Done():
-		log.Println("Shutting down due to other reason...")
+		slog.Info("shutting down due to other reason")
 	}
 
 	// Create a timeout context for the graceful shutdown
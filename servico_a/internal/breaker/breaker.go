@@ -0,0 +1,192 @@
+// Package breaker implements the circuit breaker of the calls to servico B:
+// while servico B keeps failing, requests fail fast instead of piling up behind
+// it, and a single probe goes through once it may have recovered.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrOpen is returned, without calling the upstream, while the breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State is the state of a Breaker
+type State int
+
+const (
+	// Closed lets every call through, counting consecutive failures
+	Closed State = iota
+	// HalfOpen lets a single probe through to decide whether to close again
+	HalfOpen
+	// Open fails every call fast until OpenTimeout has passed
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half_open"
+	case Open:
+		return "open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Settings tune when a Breaker opens and for how long
+type Settings struct {
+	// FailureThreshold is how many consecutive failures open the breaker
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before the half-open probe
+	OpenTimeout time.Duration
+}
+
+const (
+	DefaultFailureThreshold = 5
+	DefaultOpenTimeout      = 30 * time.Second
+)
+
+// Breaker guards the calls to a single upstream
+type Breaker struct {
+	Name     string
+	Settings Settings
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+
+	transitions metric.Int64Counter
+}
+
+// New creates a closed Breaker for the upstream name, recording its state
+// transitions and current state on meter
+func New(name string, settings Settings, meter metric.Meter) (*Breaker, error) {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = DefaultFailureThreshold
+	}
+	if settings.OpenTimeout <= 0 {
+		settings.OpenTimeout = DefaultOpenTimeout
+	}
+	b := &Breaker{Name: name, Settings: settings, now: time.Now}
+
+	var err error
+	b.transitions, err = meter.Int64Counter("circuit_breaker.transitions",
+		metric.WithDescription("Circuit breaker state transitions"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	state, err := meter.Int64ObservableGauge("circuit_breaker.state",
+		metric.WithDescription("Circuit breaker state: 0 closed, 1 half open, 2 open"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(state, int64(b.State()), metric.WithAttributes(attribute.String("breaker.name", name)))
+		return nil
+	}, state)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// State returns the current state of the breaker
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Do runs call unless the breaker is open, in which case it returns ErrOpen
+// right away. The outcome of call is recorded to decide the next state.
+func (b *Breaker) Do(ctx context.Context, call func(context.Context) error) error {
+	if err := b.allow(ctx); err != nil {
+		return err
+	}
+	err := call(ctx)
+	b.record(ctx, err)
+	return err
+}
+
+func (b *Breaker) allow(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open {
+		if b.now().Sub(b.openedAt) < b.Settings.OpenTimeout {
+			return fmt.Errorf("%s: %w", b.Name, ErrOpen)
+		}
+		b.transition(ctx, HalfOpen)
+	}
+	if b.state == HalfOpen {
+		if b.probing {
+			return fmt.Errorf("%s: %w", b.Name, ErrOpen)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *Breaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// the caller giving up says nothing about servico B
+	failed := err != nil && !errors.Is(err, context.Canceled)
+	switch b.state {
+	case HalfOpen:
+		b.probing = false
+		switch {
+		case errors.Is(err, context.Canceled):
+			// the probe was given up before it told anything, the next call
+			// probes again
+		case failed:
+			b.transition(ctx, Open)
+		default:
+			b.transition(ctx, Closed)
+		}
+	case Closed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.Settings.FailureThreshold {
+			b.transition(ctx, Open)
+		}
+	}
+}
+
+// transition moves to state, recording it on the current span and the
+// transitions metric. Must be called with mu held.
+func (b *Breaker) transition(ctx context.Context, state State) {
+	from := b.state
+	b.state = state
+	b.failures = 0
+	if state == Open {
+		b.openedAt = b.now()
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("breaker.name", b.Name),
+		attribute.String("breaker.from", from.String()),
+		attribute.String("breaker.to", state.String()),
+	}
+	trace.SpanFromContext(ctx).AddEvent("circuit breaker state change", trace.WithAttributes(attrs...))
+	b.transitions.Add(ctx, 1, metric.WithAttributes(attrs...))
+}
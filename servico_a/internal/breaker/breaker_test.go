@@ -0,0 +1,157 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var errServiceB = errors.New("servico B answered 502")
+
+// newServiceBBreaker creates the breaker of the calls to servico B as main
+// does, on a clock the test moves
+func newServiceBBreaker(t *testing.T, reader sdkmetric.Reader) (*Breaker, *time.Time) {
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	b, err := New("servico_b", Settings{FailureThreshold: 3, OpenTimeout: 30 * time.Second}, meter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestBreakerLifecycle(t *testing.T) {
+	b, now := newServiceBBreaker(t, sdkmetric.NewManualReader())
+	ctx := context.Background()
+
+	var calls int
+	for i, step := range []struct {
+		// after is how long after the previous step the request comes
+		after time.Duration
+		err   error
+		// called tells whether servico B was called or the breaker answered
+		called bool
+		state  State
+	}{
+		{0, errServiceB, true, Closed},
+		{0, nil, true, Closed},
+		// um sucesso zera a contagem, só falhas seguidas abrem o breaker
+		{0, errServiceB, true, Closed},
+		{0, errServiceB, true, Closed},
+		{0, errServiceB, true, Open},
+		// aberto, o servico B nem é chamado até o OpenTimeout passar
+		{10 * time.Second, nil, false, Open},
+		{20 * time.Second, errServiceB, true, Open},
+		{30 * time.Second, nil, true, Closed},
+	} {
+		*now = now.Add(step.after)
+		before := calls
+		err := b.Do(ctx, func(context.Context) error {
+			calls++
+			return step.err
+		})
+		assert.Equal(t, step.called, calls > before, "step %d", i)
+		if !step.called {
+			assert.ErrorIs(t, err, ErrOpen, "step %d", i)
+		}
+		assert.Equal(t, step.state, b.State(), "step %d", i)
+	}
+}
+
+func TestBreakerCanceledRequests(t *testing.T) {
+	b, now := newServiceBBreaker(t, sdkmetric.NewManualReader())
+	ctx := context.Background()
+	canceled := func(context.Context) error { return context.Canceled }
+	fail := func(context.Context) error { return errServiceB }
+
+	// o cliente desistir, como no lote em stream, não diz nada do servico B
+	for i := 0; i < 5; i++ {
+		b.Do(ctx, canceled)
+	}
+	assert.Equal(t, Closed, b.State())
+
+	for i := 0; i < 3; i++ {
+		b.Do(ctx, fail)
+	}
+	*now = now.Add(30 * time.Second)
+	// o probe cancelado libera a vaga sem fechar o breaker
+	assert.ErrorIs(t, b.Do(ctx, canceled), context.Canceled)
+	assert.Equal(t, HalfOpen, b.State())
+	assert.ErrorIs(t, b.Do(ctx, fail), errServiceB)
+	assert.Equal(t, Open, b.State())
+}
+
+func TestBreakerSingleProbe(t *testing.T) {
+	b, now := newServiceBBreaker(t, sdkmetric.NewManualReader())
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		b.Do(ctx, func(context.Context) error { return errServiceB })
+	}
+	*now = now.Add(30 * time.Second)
+
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- b.Do(ctx, func(context.Context) error {
+			close(probing)
+			<-release
+			return nil
+		})
+	}()
+	<-probing
+	// enquanto o probe não volta, as outras requisições falham na hora
+	assert.ErrorIs(t, b.Do(ctx, func(context.Context) error { return nil }), ErrOpen)
+
+	close(release)
+	assert.NoError(t, <-done)
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestBreakerTelemetry(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	b, _ := newServiceBBreaker(t, reader)
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	ctx, span := tracer.Start(context.Background(), "Chamada externa")
+	for i := 0; i < 3; i++ {
+		b.Do(ctx, func(context.Context) error { return errServiceB })
+	}
+	span.End()
+
+	transition := []attribute.KeyValue{
+		attribute.String("breaker.name", "servico_b"),
+		attribute.String("breaker.from", "closed"),
+		attribute.String("breaker.to", "open"),
+	}
+	events := recorder.Ended()[0].Events()
+	assert.Len(t, events, 1)
+	assert.Equal(t, "circuit breaker state change", events[0].Name)
+	assert.ElementsMatch(t, transition, events[0].Attributes)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		switch data := m.Data.(type) {
+		case metricdata.Sum[int64]:
+			assert.Equal(t, "circuit_breaker.transitions", m.Name)
+			assert.Len(t, data.DataPoints, 1)
+			assert.Equal(t, attribute.NewSet(transition...), data.DataPoints[0].Attributes)
+		case metricdata.Gauge[int64]:
+			assert.Equal(t, "circuit_breaker.state", m.Name)
+			assert.Equal(t, int64(Open), data.DataPoints[0].Value)
+		}
+	}
+}
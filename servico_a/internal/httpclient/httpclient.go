@@ -0,0 +1,62 @@
+// Package httpclient builds the instrumented http.Client of the calls to
+// servico B.
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Default is the client of calls made without one
+var Default = New()
+
+// New returns a client whose requests get a client span, through otelhttp, and
+// carry its trace context in the headers. Besides the otelhttp attributes, the
+// span gets the stable semantic convention ones.
+func New(opts ...otelhttp.Option) *http.Client {
+	return &http.Client{Transport: otelhttp.NewTransport(&semconvTransport{base: http.DefaultTransport}, opts...)}
+}
+
+// semconvTransport runs under the otelhttp span, which it finds in the request
+// context
+type semconvTransport struct {
+	base http.RoundTripper
+}
+
+func (t *semconvTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	span := trace.SpanFromContext(req.Context())
+	span.SetAttributes(
+		attribute.String("http.request.method", req.Method),
+		// the url of servico B carries no api key, only a password would need hiding
+		attribute.String("url.full", req.URL.Redacted()),
+		attribute.String("server.address", req.URL.Hostname()),
+		attribute.Int("server.port", port(req.URL)),
+	)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.SetAttributes(attribute.String("error.type", fmt.Sprintf("%T", err)))
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetAttributes(attribute.String("error.type", strconv.Itoa(resp.StatusCode)))
+	}
+	return resp, nil
+}
+
+func port(u *url.URL) int {
+	if p, err := strconv.Atoi(u.Port()); err == nil {
+		return p
+	}
+	if u.Scheme == "https" {
+		return 443
+	}
+	return 80
+}
@@ -0,0 +1,95 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestClientSpans(t *testing.T) {
+	var traceparent string
+	serviceB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer serviceB.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	client := New(otelhttp.WithTracerProvider(provider), otelhttp.WithPropagators(propagation.TraceContext{}))
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "Chamada externa")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, serviceB.URL+"/?fields=humidity,wind", bytes.NewBufferString(`{"cep": "01001000"}`))
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	parent.End()
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	span := spans[0]
+	assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+
+	// o servico B continua o trace a partir do span de cliente
+	assert.Contains(t, traceparent, span.SpanContext().SpanID().String())
+
+	serviceBURL, _ := url.Parse(serviceB.URL)
+	port, _ := strconv.Atoi(serviceBURL.Port())
+	for _, kv := range []attribute.KeyValue{
+		attribute.String("http.request.method", "POST"),
+		attribute.String("url.full", serviceB.URL+"/?fields=humidity,wind"),
+		attribute.String("server.address", "127.0.0.1"),
+		attribute.Int("server.port", port),
+		attribute.Int("http.response.status_code", http.StatusBadGateway),
+		attribute.String("error.type", "502"),
+	} {
+		assert.Contains(t, span.Attributes(), kv)
+	}
+}
+
+func TestClientSpanWhenServiceBIsDown(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	client := New(otelhttp.WithTracerProvider(provider))
+
+	serviceB := httptest.NewServer(http.NotFoundHandler())
+	serviceB.Close()
+	_, err := client.Post(serviceB.URL, "application/json", bytes.NewBufferString(`{"cep": "01001000"}`))
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Contains(t, spans[0].Attributes(), attribute.String("error.type", "*net.OpError"))
+}
+
+func TestClientSpanHidesPassword(t *testing.T) {
+	serviceB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer serviceB.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	client := New(otelhttp.WithTracerProvider(provider))
+
+	// EXTERNAL_CALL_URL pode levar usuário e senha de um proxy na frente do servico B
+	serviceBURL, _ := url.Parse(serviceB.URL)
+	serviceBURL.User = url.UserPassword("servico_a", "s3cr3t")
+	resp, err := client.Post(serviceBURL.String(), "application/json", bytes.NewBufferString(`{"cep": "01001000"}`))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	serviceBURL.User = url.UserPassword("servico_a", "xxxxx")
+	assert.Contains(t, recorder.Ended()[0].Attributes(), attribute.String("url.full", serviceBURL.String()))
+}
@@ -0,0 +1,23 @@
+package i18n
+
+// portuguese translates the messages of servico A, keyed by their English text
+var portuguese = map[string]string{
+	"invalid zipcode":                            "cep inválido",
+	"days must be between 1 and %d":              "days deve estar entre 1 e %d",
+	"invalid start date":                         "data inicial inválida",
+	"invalid end date":                           "data final inválida",
+	"end date before start date":                 "data final anterior à data inicial",
+	"dates must not be in the future":            "as datas não podem estar no futuro",
+	"date range too long":                        "intervalo de datas longo demais",
+	"invalid batch, expected a list of zipcodes": "lote inválido, esperada uma lista de ceps",
+	"batch larger than %d zipcodes":              "lote maior que %d ceps",
+	"batch line longer than %d bytes":            "linha do lote maior que %d bytes",
+	"could not read the batch":                   "não foi possível ler o lote",
+	"servico B is unavailable, try again later":  "serviço B indisponível, tente novamente mais tarde",
+	"could not reach servico B":                  "não foi possível falar com o serviço B",
+	"servico B answered invalid JSON":            "serviço B respondeu um JSON inválido",
+	"internal error":                             "erro interno",
+	"route not found":                            "rota não encontrada",
+	"method %s not allowed":                      "método %s não permitido",
+	"request timed out":                          "tempo da requisição esgotado",
+}
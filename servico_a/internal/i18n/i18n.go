@@ -0,0 +1,106 @@
+// Package i18n picks the language of a request from its Accept-Language header
+// and translates the errors servico A answers itself. The language is passed
+// on to servico B, which translates its own.
+package i18n
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+)
+
+// Default is the language of the messages in the code, used when the client
+// asks for none of the supported ones
+var Default = language.English
+
+// Supported lists the languages with a catalog, Default first
+var Supported = []language.Tag{Default, language.BrazilianPortuguese}
+
+var (
+	matcher  = language.NewMatcher(Supported)
+	messages = catalog.NewBuilder(catalog.Fallback(Default))
+)
+
+func init() {
+	for key, msg := range portuguese {
+		if err := messages.SetString(language.BrazilianPortuguese, key, msg); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Negotiate picks the supported language that best matches an Accept-Language
+// header, or Default
+func Negotiate(acceptLanguage string) language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return Default
+	}
+	_, index, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return Default
+	}
+	return Supported[index]
+}
+
+type contextKey struct{}
+
+// WithLanguage returns a copy of ctx carrying lang
+func WithLanguage(ctx context.Context, lang language.Tag) context.Context {
+	return context.WithValue(ctx, contextKey{}, lang)
+}
+
+// FromContext returns the language carried by ctx, or Default
+func FromContext(ctx context.Context) language.Tag {
+	if lang, ok := ctx.Value(contextKey{}).(language.Tag); ok {
+		return lang
+	}
+	return Default
+}
+
+// Middleware negotiates the language of each request, storing it in the
+// request context and announcing it in Content-Language
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := Negotiate(r.Header.Get("Accept-Language"))
+		w.Header().Set("Content-Language", lang.String())
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(w, r.WithContext(WithLanguage(r.Context(), lang)))
+	})
+}
+
+// Sprintf formats the translation of format to the language of ctx. Messages
+// without a translation are formatted as they are.
+func Sprintf(ctx context.Context, format string, args ...interface{}) string {
+	return message.NewPrinter(FromContext(ctx), message.Catalog(messages)).Sprintf(format, args...)
+}
+
+// Error is an error whose message can be translated by Message
+type Error struct {
+	format string
+	args   []interface{}
+}
+
+// Errorf returns an Error formatted from a catalog message
+func Errorf(format string, args ...interface{}) error {
+	return &Error{format: format, args: args}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf(e.format, e.args...)
+}
+
+// Message returns the message of err in the language of ctx, when it wraps an
+// Error, or its plain message otherwise
+func Message(ctx context.Context, err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return Sprintf(ctx, e.format, e.args...)
+	}
+	return err.Error()
+}
@@ -0,0 +1,49 @@
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func TestNegotiate(t *testing.T) {
+	for header, expected := range map[string]language.Tag{
+		"":                        language.English,
+		"pt-BR,pt;q=0.9,en;q=0.8": language.BrazilianPortuguese,
+		"pt":                      language.BrazilianPortuguese,
+		"en-US,pt;q=0.5":          language.English,
+		"fr-FR":                   language.English,
+		"not a language;;":        language.English,
+	} {
+		assert.Equal(t, expected, Negotiate(header), header)
+	}
+}
+
+func TestSprintf(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "batch larger than 10 zipcodes", Sprintf(ctx, "batch larger than %d zipcodes", 10))
+
+	ctx = WithLanguage(ctx, language.BrazilianPortuguese)
+	assert.Equal(t, "lote maior que 10 ceps", Sprintf(ctx, "batch larger than %d zipcodes", 10))
+	assert.Equal(t, "data final inválida", Message(ctx, fmt.Errorf("history: %w", Errorf("invalid end date"))))
+}
+
+func TestMiddleware(t *testing.T) {
+	var lang language.Tag
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang = FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "pt")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, language.BrazilianPortuguese, lang)
+	assert.Equal(t, "pt-BR", w.Header().Get("Content-Language"))
+}
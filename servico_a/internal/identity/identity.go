@@ -0,0 +1,122 @@
+// Package identity tells who a request comes from and carries it in the W3C
+// baggage, so servico B, which only sees servico A, learns the client, the
+// tenant and the channel of each request and tags its spans with them.
+package identity
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// Baggage keys of the identity, also the span attributes servico B sets
+const (
+	ClientIDKey = "client.id"
+	TenantKey   = "tenant.id"
+	ChannelKey  = "request.channel"
+)
+
+// Headers the identity is read from
+const (
+	APIKeyHeader  = "X-API-Key"
+	ChannelHeader = "X-Channel"
+)
+
+// A request naming no channel is DefaultChannel, one naming a channel not set
+// up is OtherChannel, which keeps the number of values bounded
+const (
+	DefaultChannel = "api"
+	OtherChannel   = "other"
+)
+
+// DefaultChannels are the channels told apart when no others are set up
+var DefaultChannels = []string{"web", "mobile", "api"}
+
+// Client is who an api key authenticates
+type Client struct {
+	ID     string
+	Tenant string
+}
+
+// Clients maps api keys to their clients
+type Clients map[string]Client
+
+// ParseClients parses the comma separated key=client:tenant entries of s, as
+// in "k3y=acme:retail,0th3r=globex:bank". The tenant may be left out.
+func ParseClients(s string) (Clients, error) {
+	clients := Clients{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, who, ok := strings.Cut(entry, "=")
+		if !ok || key == "" || who == "" {
+			return nil, fmt.Errorf("client entry %q is not key=client:tenant", entry)
+		}
+		id, tenant, _ := strings.Cut(who, ":")
+		clients[key] = Client{ID: id, Tenant: tenant}
+	}
+	return clients, nil
+}
+
+// Middleware puts the identity of each request in the baggage of its context:
+// the client and tenant of its api key, when the key is known, and its
+// channel, one of channels. Baggage sent by the caller is dropped, the identity
+// is only what servico A authenticated. Requests with no known key still go
+// through, they are just anonymous.
+func Middleware(clients Clients, channels []string) func(http.Handler) http.Handler {
+	known := map[string]bool{}
+	for _, channel := range channels {
+		known[strings.ToLower(strings.TrimSpace(channel))] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Del("Baggage")
+
+			channel := strings.ToLower(strings.TrimSpace(r.Header.Get(ChannelHeader)))
+			switch {
+			case channel == "":
+				channel = DefaultChannel
+			case !known[channel]:
+				channel = OtherChannel
+			}
+			values := map[string]string{ChannelKey: channel}
+			if client, ok := clients[r.Header.Get(APIKeyHeader)]; ok {
+				values[ClientIDKey] = client.ID
+				values[TenantKey] = client.Tenant
+			}
+			next.ServeHTTP(w, r.WithContext(withBaggage(r.Context(), values)))
+		})
+	}
+}
+
+// withBaggage returns a copy of ctx with values in a baggage of their own,
+// empty values left out
+func withBaggage(ctx context.Context, values map[string]string) context.Context {
+	var members []baggage.Member
+	for key, value := range values {
+		if value == "" {
+			continue
+		}
+		member, err := baggage.NewMemberRaw(key, value)
+		if err != nil {
+			continue
+		}
+		members = append(members, member)
+	}
+	b, err := baggage.New(members...)
+	if err != nil {
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, b)
+}
+
+// FromContext returns the client and channel in the baggage of ctx
+func FromContext(ctx context.Context) (Client, string) {
+	b := baggage.FromContext(ctx)
+	return Client{ID: b.Member(ClientIDKey).Value(), Tenant: b.Member(TenantKey).Value()}, b.Member(ChannelKey).Value()
+}
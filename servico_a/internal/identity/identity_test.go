@@ -0,0 +1,58 @@
+package identity
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/baggage"
+)
+
+func TestParseClients(t *testing.T) {
+	clients, err := ParseClients("k3y=acme:retail, 0th3r=globex,")
+	assert.NoError(t, err)
+	assert.Equal(t, Clients{
+		"k3y":   {ID: "acme", Tenant: "retail"},
+		"0th3r": {ID: "globex"},
+	}, clients)
+
+	_, err = ParseClients("k3y")
+	assert.Error(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	clients := Clients{"k3y": {ID: "acme", Tenant: "retail"}}
+	for _, test := range []struct {
+		name    string
+		headers map[string]string
+		client  Client
+		channel string
+	}{
+		{"autenticado", map[string]string{APIKeyHeader: "k3y", ChannelHeader: "Mobile"}, Client{ID: "acme", Tenant: "retail"}, "mobile"},
+		{"anônimo", map[string]string{APIKeyHeader: "wrong"}, Client{}, DefaultChannel},
+		{"canal desconhecido", map[string]string{ChannelHeader: "fax"}, Client{}, OtherChannel},
+		// o baggage do chamador não é confiável e é descartado
+		{"baggage forjado", map[string]string{"Baggage": "client.id=evil,tenant.id=evil"}, Client{}, DefaultChannel},
+	} {
+		var client Client
+		var channel string
+		var members int
+		handler := Middleware(clients, DefaultChannels)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client, channel = FromContext(r.Context())
+			members = baggage.FromContext(r.Context()).Len()
+			assert.Empty(t, r.Header.Get("Baggage"), test.name)
+		}))
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		for key, value := range test.headers {
+			r.Header.Set(key, value)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+
+		assert.Equal(t, test.client, client, test.name)
+		assert.Equal(t, test.channel, channel, test.name)
+		if test.client.ID == "" {
+			assert.Equal(t, 1, members, test.name)
+		}
+	}
+}
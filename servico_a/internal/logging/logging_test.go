@@ -0,0 +1,161 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"servico_a/internal/tracing"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// lines decodes the JSON records written to buf
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestNew(t *testing.T) {
+	var out, bridged bytes.Buffer
+	// como o main monta o logger com LOG_LEVEL=warn e a ponte do OTel
+	logger, err := New(&out, Options{
+		Level:  slog.LevelWarn,
+		Bridge: slog.NewJSONHandler(&bridged, nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	ctx, span := tracer.Start(context.Background(), "Chamada externa")
+	defer span.End()
+
+	logger.InfoContext(ctx, "weather asked")
+	logger.With("cep", "01001000").ErrorContext(ctx, "call failed", "status", http.StatusBadGateway)
+	logger.Warn("no trace")
+
+	records := lines(t, &out)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "call failed", records[0]["msg"])
+	assert.Equal(t, "01001000", records[0]["cep"])
+	assert.Equal(t, float64(http.StatusBadGateway), records[0]["status"])
+	assert.Equal(t, span.SpanContext().TraceID().String(), records[0][TraceIDKey])
+	assert.Equal(t, span.SpanContext().SpanID().String(), records[0][SpanIDKey])
+	assert.NotContains(t, records[1], TraceIDKey)
+
+	// a ponte recebe o mesmo nível e atributos, e lê o trace do contexto por conta própria
+	bridgedRecords := lines(t, &bridged)
+	assert.Len(t, bridgedRecords, 2)
+	assert.Equal(t, "01001000", bridgedRecords[0]["cep"])
+	assert.NotContains(t, bridgedRecords[0], TraceIDKey)
+}
+
+func TestNewFormats(t *testing.T) {
+	for _, test := range []struct {
+		format string
+		line   string
+	}{
+		{"", `"msg":"servico A listening"`},
+		{FormatJSON, `"msg":"servico A listening"`},
+		{FormatText, `msg="servico A listening"`},
+	} {
+		var out bytes.Buffer
+		logger, err := New(&out, Options{Format: test.format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger.Info("servico A listening")
+		assert.Contains(t, out.String(), test.line, test.format)
+	}
+
+	// um LOG_FORMAT desconhecido impede o serviço de subir
+	_, err := New(&bytes.Buffer{}, Options{Format: "xml"})
+	assert.Error(t, err)
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		level slog.Level
+	}{
+		{"info", slog.LevelInfo},
+		{"debug", slog.LevelDebug},
+		{"WARN", slog.LevelWarn},
+		{"error", slog.LevelError},
+	} {
+		level, err := ParseLevel(test.name)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.level, level, test.name)
+	}
+	_, err := ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logger)
+
+	// como o CreateServer encadeia o id da requisição e o log
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	traceIDs := map[string]string{}
+	router := chi.NewRouter()
+	router.Use(middleware.RequestID)
+	router.Use(Middleware)
+	router.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracing.StartServer(tracer, w, r, "Chamada externa")
+		defer span.End()
+		traceIDs[r.URL.Path] = span.SpanContext().TraceID().String()
+		span.Writer.WriteHeader(http.StatusUnprocessableEntity)
+	})
+	router.Post("/history", func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracing.StartServer(tracer, w, r, "Chamada externa")
+		defer span.End()
+		traceIDs[r.URL.Path] = span.SpanContext().TraceID().String()
+		// o breaker do servico B aberto
+		span.Writer.WriteHeader(http.StatusServiceUnavailable)
+	})
+	for _, path := range []string{"/", "/history"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"cep": "01001000"}`)))
+	}
+
+	records := lines(t, &out)
+	assert.Len(t, records, 2)
+	for _, record := range records {
+		assert.NotEmpty(t, record["request_id"])
+		assert.Equal(t, http.MethodPost, record["http.request.method"])
+	}
+
+	// um cep inválido é erro do cliente, fica no nível info
+	assert.Equal(t, "INFO", records[0]["level"])
+	assert.Equal(t, "/", records[0]["url.path"])
+	assert.Equal(t, float64(http.StatusUnprocessableEntity), records[0]["http.response.status_code"])
+	assert.Equal(t, traceIDs["/"], records[0][TraceIDKey])
+
+	assert.Equal(t, "ERROR", records[1]["level"])
+	assert.Equal(t, "/history", records[1]["url.path"])
+	assert.Equal(t, float64(http.StatusServiceUnavailable), records[1]["http.response.status_code"])
+	// o log da requisição leva o trace do span aberto pelo handler
+	assert.Equal(t, traceIDs["/history"], records[1][TraceIDKey])
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func newTestMetrics(t *testing.T) (*Metrics, func() map[string]metricdata.Aggregation) {
+	reader := sdkmetric.NewManualReader()
+	m, err := New(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collect := func() map[string]metricdata.Aggregation {
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(context.Background(), &rm); err != nil {
+			t.Fatal(err)
+		}
+		data := map[string]metricdata.Aggregation{}
+		for _, m := range rm.ScopeMetrics[0].Metrics {
+			data[m.Name] = m.Data
+		}
+		return data
+	}
+	return m, collect
+}
+
+func TestMiddleware(t *testing.T) {
+	m, collect := newTestMetrics(t)
+
+	// as rotas do servico A, o lote fora do grupo do breaker
+	router := chi.NewRouter()
+	router.Use(m.Middleware)
+	router.Post("/", func(w http.ResponseWriter, r *http.Request) {})
+	router.Post("/history", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	router.Post("/batch", func(w http.ResponseWriter, r *http.Request) {})
+	for _, path := range []string{"/", "/", "/history", "/batch"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	}
+
+	points := collect()["http.server.request.duration"].(metricdata.Histogram[float64]).DataPoints
+	assert.Len(t, points, 3)
+	counts := map[attribute.Set]uint64{}
+	for _, p := range points {
+		counts[p.Attributes] = p.Count
+	}
+	// chi deixa o padrão de "/" vazio, a rota continua sendo "/"
+	assert.Equal(t, uint64(2), counts[attribute.NewSet(
+		attribute.String("http.request.method", "POST"),
+		attribute.String("http.route", "/"),
+		attribute.Int("http.response.status_code", http.StatusOK),
+	)])
+	assert.Equal(t, uint64(1), counts[attribute.NewSet(
+		attribute.String("http.request.method", "POST"),
+		attribute.String("http.route", "/history"),
+		attribute.Int("http.response.status_code", http.StatusServiceUnavailable),
+		attribute.String("error.type", "503"),
+	)])
+	assert.Equal(t, uint64(1), counts[attribute.NewSet(
+		attribute.String("http.request.method", "POST"),
+		attribute.String("http.route", "/batch"),
+		attribute.Int("http.response.status_code", http.StatusOK),
+	)])
+}
+
+func TestRecordServiceB(t *testing.T) {
+	m, collect := newTestMetrics(t)
+	ctx := context.Background()
+
+	// as saídas de callOutcome, o breaker aberto responde sem chamar o servico B
+	m.RecordServiceB(ctx, "success", 20*time.Millisecond)
+	m.RecordServiceB(ctx, "success", 30*time.Millisecond)
+	m.RecordServiceB(ctx, "circuit_open", 0)
+	m.RecordServiceB(ctx, "timeout", 5*time.Second)
+
+	points := collect()["upstream.request.duration"].(metricdata.Histogram[float64]).DataPoints
+	assert.Len(t, points, 3)
+	counts := map[string]uint64{}
+	for _, p := range points {
+		name, _ := p.Attributes.Value("upstream.name")
+		assert.Equal(t, "servico_b", name.AsString())
+		outcome, _ := p.Attributes.Value("outcome")
+		counts[outcome.AsString()] = p.Count
+		if outcome.AsString() == "timeout" {
+			assert.Equal(t, 5.0, p.Sum)
+		}
+	}
+	assert.Equal(t, map[string]uint64{"success": 2, "circuit_open": 1, "timeout": 1}, counts)
+}
+
+func TestRecordCepLookup(t *testing.T) {
+	m, collect := newTestMetrics(t)
+	ctx := context.Background()
+
+	m.RecordCepLookup(ctx, CepFound)
+	m.RecordCepLookup(ctx, CepNotFound)
+	m.RecordCepLookup(ctx, CepNotFound)
+	m.RecordCepLookup(ctx, CepInvalid)
+	// o breaker aberto não consultou cep nenhum
+	m.RecordCepLookup(ctx, "")
+
+	values := map[string]int64{}
+	for _, p := range collect()["cep.lookups"].(metricdata.Sum[int64]).DataPoints {
+		values[p.Attributes.Encoded(attribute.DefaultEncoder())] = p.Value
+	}
+	assert.Equal(t, map[string]int64{"outcome=found": 1, "outcome=not_found": 2, "outcome=invalid": 1}, values)
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	ctx := context.Background()
+
+	// sem métricas nada é gravado, e nada quebra
+	m.RecordServiceB(ctx, "success", time.Millisecond)
+	m.RecordCepLookup(ctx, CepFound)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	w := httptest.NewRecorder()
+	m.Middleware(next).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,96 @@
+// Package problem renders errors as RFC 7807 problem details, so every error
+// answer has the same shape whatever failed.
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContentType is the media type of a problem document
+const ContentType = "application/problem+json"
+
+// Stable error codes, clients may rely on them. Problems answered by servico B
+// are passed on untouched and carry its own codes.
+const (
+	CodeInvalidZipcode        = "invalid_zipcode"
+	CodeInvalidDays           = "invalid_days"
+	CodeInvalidDateRange      = "invalid_date_range"
+	CodeInvalidBatch          = "invalid_batch"
+	CodeBatchTooLarge         = "batch_too_large"
+	CodeServiceBUnavailable   = "service_b_unavailable"
+	CodeServiceBUnreachable   = "service_b_unreachable"
+	CodeInvalidServiceBAnswer = "invalid_service_b_answer"
+	CodeRouteNotFound         = "route_not_found"
+	CodeMethodNotAllowed      = "method_not_allowed"
+	CodeTimeout               = "timeout"
+	CodeInternal              = "internal_error"
+)
+
+// Codes answered by servico B that servico A tells apart
+const (
+	CodeZipcodeNotFound     = "zipcode_not_found"
+	CodeInvalidFields       = "invalid_fields"
+	CodeWeatherLookupFailed = "weather_lookup_failed"
+)
+
+// Problem is an RFC 7807 problem document. Code and TraceID are extensions:
+// Code identifies the error and TraceID the trace of the failed request.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	TraceID  string `json:"trace_id,omitempty"`
+}
+
+// New creates a problem with status and code. Problems are told apart by Code,
+// so Type is about:blank and Title the status text.
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("%s: %s", p.Code, p.Detail)
+}
+
+// Marshal encodes p stamped with the trace ID of ctx
+func Marshal(ctx context.Context, p *Problem) []byte {
+	doc := *p
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		doc.TraceID = sc.TraceID().String()
+	}
+	body, _ := json.Marshal(doc)
+	return body
+}
+
+// CodeOf returns the code of the problem document in body, as servico B
+// answers its errors, or "" when body is not one
+func CodeOf(body []byte) string {
+	var p Problem
+	if err := json.Unmarshal(body, &p); err != nil {
+		return ""
+	}
+	return p.Code
+}
+
+// Write answers the request with p, stamped with the trace ID of ctx
+func Write(ctx context.Context, w http.ResponseWriter, p *Problem) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	w.Write(Marshal(ctx, p))
+	w.Write([]byte("\n"))
+}
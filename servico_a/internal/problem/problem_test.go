@@ -0,0 +1,56 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestWrite(t *testing.T) {
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	ctx, span := tracer.Start(context.Background(), "Chamada externa")
+	defer span.End()
+
+	w := httptest.NewRecorder()
+	Write(ctx, w, New(http.StatusServiceUnavailable, CodeServiceBUnavailable, "servico B is unavailable, try again later"))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Problem{
+		Type:    "about:blank",
+		Title:   "Service Unavailable",
+		Status:  http.StatusServiceUnavailable,
+		Detail:  "servico B is unavailable, try again later",
+		Code:    CodeServiceBUnavailable,
+		TraceID: span.SpanContext().TraceID().String(),
+	}, p)
+}
+
+func TestMarshalWithoutTrace(t *testing.T) {
+	// o que o servico B respondeu fora do formato vira um problema do servico A
+	body := Marshal(context.Background(), New(http.StatusBadGateway, CodeInvalidServiceBAnswer, "bad gateway"))
+	assert.JSONEq(t, `{"type": "about:blank", "title": "Bad Gateway", "status": 502, "detail": "bad gateway", "code": "invalid_service_b_answer"}`, string(body))
+}
+
+func TestCodeOf(t *testing.T) {
+	for body, code := range map[string]string{
+		`{"status": 404, "code": "zipcode_not_found"}`:     CodeZipcodeNotFound,
+		`{"status": 500, "code": "weather_lookup_failed"}`: CodeWeatherLookupFailed,
+		`{"status": 502}`: "",
+		"bad gateway":     "",
+		"":                "",
+	} {
+		assert.Equal(t, code, CodeOf([]byte(body)), body)
+	}
+}
@@ -0,0 +1,52 @@
+package tracing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Domain attributes of the request spans, the ones traces are searched by
+const (
+	// CepKey is the CEP asked for, digits only, or its hash, see Cep
+	CepKey = attribute.Key("cep")
+	// LocalityKey and StateKey are where the CEP resolved to
+	LocalityKey = attribute.Key("address.localidade")
+	StateKey    = attribute.Key("address.uf")
+	// CepProviderKey and WeatherProviderKey name the providers that answered
+	CepProviderKey     = attribute.Key("cep.provider")
+	WeatherProviderKey = attribute.Key("weather.provider")
+	// WeatherCacheStatusKey is stale when servico B answered the weather from
+	// its cache past the TTL
+	WeatherCacheStatusKey = attribute.Key("weather.cache.status")
+	// TempCKey, TempFKey and TempKKey are the temperatures answered
+	TempCKey = attribute.Key("weather.temp_c")
+	TempFKey = attribute.Key("weather.temp_f")
+	TempKKey = attribute.Key("weather.temp_k")
+)
+
+// ValidationFailedEvent is added to the request span when the request is refused
+const ValidationFailedEvent = "validation failed"
+
+// Cep is the CepKey attribute of cep, normalized to its digits. With a
+// hashKey the CEP is sent as the hex HMAC-SHA256 of the digits instead, so
+// traces of a CEP can still be found by hashing it with the same key while the
+// collector never sees it. A plain hash would not do, there are only 10^8 CEPs.
+func Cep(cep string, hashKey []byte) attribute.KeyValue {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, cep)
+	if len(hashKey) == 0 {
+		return CepKey.String(digits)
+	}
+	mac := hmac.New(sha256.New, hashKey)
+	mac.Write([]byte(digits))
+	return CepKey.String(hex.EncodeToString(mac.Sum(nil)))
+}
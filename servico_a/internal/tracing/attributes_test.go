@@ -0,0 +1,17 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCep(t *testing.T) {
+	assert.Equal(t, CepKey.String("01001000"), Cep("01001000", nil))
+
+	// o HMAC-SHA256 dos dígitos, o mesmo valor que o servico B grava com a
+	// mesma CEP_HASH_KEY, então um hash acha o trace nos dois serviços
+	hashed := Cep("01001000", []byte("chave"))
+	assert.Equal(t, CepKey.String("9098116ffc7a21e6c6309b8647be91eb1e01a8f12895da2b8be0a65808a6baa6"), hashed)
+	assert.NotEqual(t, hashed, Cep("01001000", []byte("outra")))
+}
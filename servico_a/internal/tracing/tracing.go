@@ -0,0 +1,147 @@
+// Package tracing ends the spans of servico A with the outcome of the work they
+// cover: errors are recorded with their classification and the status follows
+// the HTTP answer, so failed requests and calls to servico B stand out in the
+// traces.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/go-chi/chi/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errorTypeOther is the error.type of errors with no better classification
+const errorTypeOther = "_OTHER"
+
+// registered is an error classified by RegisterError
+type registered struct {
+	target    error
+	errorType string
+	expected  bool
+}
+
+var (
+	mu         sync.RWMutex
+	registry   []registered
+	unexported = map[string]bool{
+		"*errors.errorString": true,
+		"*errors.joinError":   true,
+		"*fmt.wrapError":      true,
+		"*fmt.wrapErrors":     true,
+	}
+)
+
+// RegisterError classifies target, and the errors wrapping it, as errorType.
+// Expected errors, such as a zip code that does not exist, are an answer and
+// not a failure: they are recorded without setting the span status to Error.
+func RegisterError(target error, errorType string, expected bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry = append(registry, registered{target: target, errorType: errorType, expected: expected})
+}
+
+// errorType classifies err for the error.type attribute, telling whether it
+// is expected. Registered errors come first, then context errors. Any other
+// error, such as the *url.Error of a call to servico B that failed, is named
+// after its type, or errorTypeOther when the type says nothing about it.
+func errorType(err error) (string, bool) {
+	mu.RLock()
+	for _, r := range registry {
+		if errors.Is(err, r.target) {
+			mu.RUnlock()
+			return r.errorType, r.expected
+		}
+	}
+	mu.RUnlock()
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout", false
+	case errors.Is(err, context.Canceled):
+		// the caller gave up, nothing failed on this side
+		return "canceled", true
+	}
+	if name := fmt.Sprintf("%T", err); !unexported[name] {
+		return name, false
+	}
+	return errorTypeOther, false
+}
+
+// RecordError records err on span with its error.type, setting the status to
+// Error unless err is expected. A nil err is ignored.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	errType, expected := errorType(err)
+	span.RecordError(err, trace.WithAttributes(attribute.String("error.type", errType)))
+	span.SetAttributes(attribute.String("error.type", errType))
+	if !expected {
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// SetHTTPStatus sets the status code answered on span, with an Error status
+// for server errors. Client errors are the caller's, so they leave it unset.
+func SetHTTPStatus(span trace.Span, status int) {
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetAttributes(attribute.String("error.type", fmt.Sprint(status)))
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// ServerSpan is the span of a request to a handler. Writer remembers the
+// status answered through it, which sets the span status when it ends.
+type ServerSpan struct {
+	trace.Span
+	Writer middleware.WrapResponseWriter
+}
+
+// StartServer starts the span of r, continuing the trace propagated by its
+// caller. The handler answers through the Writer of the span and ends it with
+// defer, so the span is closed with the status answered whatever the path.
+func StartServer(tracer trace.Tracer, w http.ResponseWriter, r *http.Request, name string) (context.Context, *ServerSpan) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+	if slot, ok := r.Context().Value(spanSlotKey{}).(*spanSlot); ok {
+		slot.span = span
+	}
+	return ctx, &ServerSpan{Span: span, Writer: middleware.NewWrapResponseWriter(w, r.ProtoMajor)}
+}
+
+// End sets the status answered on the span and ends it. A handler that wrote
+// nothing answered 200.
+func (s *ServerSpan) End(options ...trace.SpanEndOption) {
+	status := s.Writer.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	SetHTTPStatus(s.Span, status)
+	s.Span.End(options...)
+}
+
+// spanSlot holds the span StartServer started for a request
+type spanSlot struct {
+	span trace.Span
+}
+
+type spanSlotKey struct{}
+
+// WithSpanSlot returns a copy of ctx in which StartServer leaves the span of
+// the request, for middleware that runs around the handler and needs the span
+// afterwards, such as the request log. The func returned gives the span, nil
+// when the handler started none.
+func WithSpanSlot(ctx context.Context) (context.Context, func() trace.Span) {
+	slot := &spanSlot{}
+	return context.WithValue(ctx, spanSlotKey{}, slot), func() trace.Span { return slot.span }
+}
@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"servico_a/internal/breaker"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func init() {
+	// como o pacote web registra o breaker do servico B
+	RegisterError(breaker.ErrOpen, "circuit_open", false)
+}
+
+func TestRecordError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	// os erros de uma chamada ao servico B que não teve resposta
+	refused := &url.Error{Op: "Post", URL: "http://servico-b:8081", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+	for _, test := range []struct {
+		err       error
+		errorType string
+		status    codes.Code
+	}{
+		{nil, "", codes.Unset},
+		{fmt.Errorf("servico_b: %w", breaker.ErrOpen), "circuit_open", codes.Error},
+		{&url.Error{Op: "Post", URL: "http://servico-b:8081", Err: context.DeadlineExceeded}, "timeout", codes.Error},
+		{refused, "*url.Error", codes.Error},
+		// o cliente desistiu, não é falha do servico A
+		{context.Canceled, "canceled", codes.Unset},
+		{errors.New("servico B answered 502"), errorTypeOther, codes.Error},
+	} {
+		_, span := tracer.Start(context.Background(), "Chamada externa")
+		RecordError(span, test.err)
+		span.End()
+
+		ended := recorder.Ended()
+		s := ended[len(ended)-1]
+		assert.Equal(t, test.status, s.Status().Code, test.errorType)
+		if test.err == nil {
+			assert.Empty(t, s.Events())
+			assert.Empty(t, s.Attributes())
+			continue
+		}
+		assert.Contains(t, s.Attributes(), attribute.String("error.type", test.errorType))
+		assert.Len(t, s.Events(), 1)
+		assert.Equal(t, "exception", s.Events()[0].Name)
+		assert.Contains(t, s.Events()[0].Attributes, attribute.String("error.type", test.errorType))
+	}
+}
+
+func TestServerSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	// como o HandleRequest responde: o clima, um cep inválido e o breaker aberto
+	for _, status := range []int{0, http.StatusUnprocessableEntity, http.StatusServiceUnavailable} {
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			_, span := StartServer(tracer, w, r, "Chamada externa")
+			defer span.End()
+			w = span.Writer
+
+			if status != 0 {
+				w.WriteHeader(status)
+			}
+		}
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	}
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 3)
+	for _, span := range spans {
+		assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	}
+
+	assert.Contains(t, spans[0].Attributes(), attribute.Int("http.response.status_code", http.StatusOK))
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	// o cep inválido é erro do cliente
+	assert.Contains(t, spans[1].Attributes(), attribute.Int("http.response.status_code", http.StatusUnprocessableEntity))
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+
+	assert.Contains(t, spans[2].Attributes(), attribute.Int("http.response.status_code", http.StatusServiceUnavailable))
+	assert.Contains(t, spans[2].Attributes(), attribute.String("error.type", "503"))
+	assert.Equal(t, codes.Error, spans[2].Status().Code)
+}
+
+func TestSpanSlot(t *testing.T) {
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+
+	ctx, span := WithSpanSlot(context.Background())
+	assert.Nil(t, span())
+
+	// o log da requisição acha o span aberto pelo handler, que roda dentro dele
+	r := httptest.NewRequest(http.MethodPost, "/", nil).WithContext(ctx)
+	_, started := StartServer(tracer, httptest.NewRecorder(), r, "Chamada externa")
+	started.End()
+	assert.Equal(t, started.SpanContext(), span().SpanContext())
+}
@@ -0,0 +1,158 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"servico_a/internal/i18n"
+	"servico_a/internal/metrics"
+	"servico_a/internal/problem"
+	"servico_a/internal/tracing"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultBatchConcurrency = 10
+	defaultBatchMaxSize     = 1000
+)
+
+// BatchItemResult is the outcome of a single CEP of a batch, with either the
+// servico B answer in Result or its error in Error
+type BatchItemResult struct {
+	Cep    string          `json:"cep"`
+	Status int             `json:"status"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  json.RawMessage `json:"error,omitempty"`
+	// TraceID identifies the trace of the item, which is not the batch one
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// HandleBatch looks up the weather of a list of CEPs, answering one result per
+// CEP in the same order they were sent. NDJSON bodies are streamed instead, see
+// HandleBatchStream.
+func (h *Webserver) HandleBatch(w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == ndjsonContentType {
+		h.HandleBatchStream(w, r)
+		return
+	}
+
+	ctx, span := tracing.StartServer(h.ServiceData.OTELTracer, w, r, "Lote"+h.ServiceData.RequestNameOTEL)
+	defer span.End()
+	w = span.Writer
+
+	var ceps []string
+	err := json.NewDecoder(r.Body).Decode(&ceps)
+	if err != nil {
+		h.rejectRequest(ctx, w, "batch", problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidBatch,
+			i18n.Sprintf(ctx, "invalid batch, expected a list of zipcodes")))
+		return
+	}
+	if maxSize := h.batchMaxSize(); len(ceps) > maxSize {
+		h.rejectRequest(ctx, w, "batch", problem.New(http.StatusRequestEntityTooLarge, problem.CodeBatchTooLarge,
+			i18n.Sprintf(ctx, "batch larger than %d zipcodes", maxSize)))
+		return
+	}
+	span.SetAttributes(attribute.Int("batch.size", len(ceps)))
+
+	results := make([]BatchItemResult, len(ceps))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, h.batchConcurrency())
+	for i, cep := range ceps {
+		wg.Add(1)
+		go func(i int, cep string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = h.lookupBatchItem(ctx, i, cep)
+		}(i, cep)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// lookupBatchItem asks servico B for a single CEP of a batch. Each item gets its
+// own trace, linked to the batch span, so large batches do not end up as one
+// huge trace.
+func (h *Webserver) lookupBatchItem(ctx context.Context, index int, cep string) (result BatchItemResult) {
+	ctx, span := h.ServiceData.OTELTracer.Start(ctx, "Item do lote"+h.ServiceData.RequestNameOTEL,
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.Link{SpanContext: trace.SpanContextFromContext(ctx)}),
+		trace.WithAttributes(
+			attribute.Int("batch.index", index),
+			tracing.Cep(cep, h.ServiceData.CepHashKey),
+		),
+	)
+	defer func() {
+		tracing.SetHTTPStatus(span, result.Status)
+		span.End()
+	}()
+
+	result = BatchItemResult{Cep: cep}
+	if sc := span.SpanContext(); sc.HasTraceID() {
+		result.TraceID = sc.TraceID().String()
+	}
+	if len(cep) != 8 {
+		h.ServiceData.Metrics.RecordCepLookup(ctx, metrics.CepInvalid)
+		span.AddEvent(tracing.ValidationFailedEvent, trace.WithAttributes(
+			attribute.String("validation.field", "cep"),
+			attribute.String("problem.code", problem.CodeInvalidZipcode),
+		))
+		return result.failed(ctx, problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidZipcode, i18n.Sprintf(ctx, "invalid zipcode")))
+	}
+
+	resp, err := h.callServiceB(ctx, "", map[string]string{"cep": cep})
+	if err != nil {
+		tracing.RecordError(span, err)
+		return result.failed(ctx, callProblem(ctx, err))
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return result.failed(ctx, callProblem(ctx, err))
+	}
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	if resp.StatusCode != http.StatusOK {
+		h.ServiceData.Metrics.RecordCepLookup(ctx, lookupOutcome(resp.StatusCode, body))
+		result.Status = resp.StatusCode
+		result.Error = serviceBProblem(ctx, resp, body)
+		return result
+	}
+	if !json.Valid(body) {
+		return result.failed(ctx, problem.New(http.StatusBadGateway, problem.CodeInvalidServiceBAnswer, i18n.Sprintf(ctx, "servico B answered invalid JSON")))
+	}
+	span.SetAttributes(answerAttributes(body)...)
+	h.ServiceData.Metrics.RecordCepLookup(ctx, metrics.CepFound)
+	result.Status = http.StatusOK
+	result.Result = body
+	return result
+}
+
+// failed sets p, stamped with the trace of the item, as the outcome of r
+func (r BatchItemResult) failed(ctx context.Context, p *problem.Problem) BatchItemResult {
+	r.Status = p.Status
+	r.Error = problem.Marshal(ctx, p)
+	return r
+}
+
+func (h *Webserver) batchConcurrency() int {
+	if h.ServiceData.BatchConcurrency > 0 {
+		return h.ServiceData.BatchConcurrency
+	}
+	return defaultBatchConcurrency
+}
+
+func (h *Webserver) batchMaxSize() int {
+	if h.ServiceData.BatchMaxSize > 0 {
+		return h.ServiceData.BatchMaxSize
+	}
+	return defaultBatchMaxSize
+}
@@ -0,0 +1,171 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"servico_a/internal/i18n"
+	"servico_a/internal/problem"
+	"servico_a/internal/tracing"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+// maxStreamLine bounds a single line of an NDJSON batch
+const maxStreamLine = 64 * 1024
+
+// BatchStreamResult is a line of a streamed batch. Lines are written as soon as
+// each CEP completes, so Index tells which input line it answers.
+type BatchStreamResult struct {
+	Index int `json:"index"`
+	BatchItemResult
+}
+
+// HandleBatchStream looks up the weather of an NDJSON list of CEPs, one per line
+// either as a JSON string or as {"cep": "..."}, writing back one NDJSON line per
+// CEP as soon as it completes. The body is read while results are written, so
+// lists of any size can be sent without buffering them on either side.
+func (h *Webserver) HandleBatchStream(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServer(h.ServiceData.OTELTracer, w, r, "Lote em stream"+h.ServiceData.RequestNameOTEL)
+	defer span.End()
+	w = span.Writer
+
+	// the client going away cancels r.Context, a failed write cancels the rest
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	// HTTP/1.x stops reading the body once the response starts unless asked
+	// not to; HTTP/2 is always full duplex and answers ErrNotSupported
+	rc.EnableFullDuplex()
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	results := make(chan BatchStreamResult)
+	var count int
+	var readErr error
+	go func() {
+		count, readErr = h.dispatchStream(ctx, r.Body, results)
+		close(results)
+	}()
+
+	enc := json.NewEncoder(w)
+	var written int
+	for result := range results {
+		if ctx.Err() != nil {
+			continue
+		}
+		if err := enc.Encode(result); err != nil {
+			cancel()
+			continue
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			cancel()
+			continue
+		}
+		written++
+	}
+	// the status is already sent, so a batch that could not be read to its end
+	// says so in a last line, at the index of the line it stopped at
+	if readErr != nil && ctx.Err() == nil {
+		last := BatchStreamResult{Index: count, BatchItemResult: BatchItemResult{}.failed(ctx, streamReadProblem(ctx, readErr))}
+		if err := enc.Encode(last); err == nil {
+			rc.Flush()
+		}
+	}
+
+	span.SetAttributes(
+		attribute.Int("batch.size", count),
+		attribute.Int("batch.written", written),
+	)
+	switch {
+	case readErr != nil:
+		tracing.RecordError(span, readErr)
+		span.SetStatus(codes.Error, "could not read batch")
+	case ctx.Err() != nil && written < count:
+		span.SetStatus(codes.Error, "batch canceled")
+	}
+}
+
+// dispatchStream reads CEPs from body and looks each one up with bounded
+// concurrency, sending the results to out until ctx is done. It returns how many
+// lines were dispatched.
+func (h *Webserver) dispatchStream(ctx context.Context, body io.Reader, out chan<- BatchStreamResult) (int, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 4096), maxStreamLine)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	sem := make(chan struct{}, h.batchConcurrency())
+	index := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return index, nil
+		}
+
+		cep, ok := parseStreamCep(line)
+		if !ok {
+			cep = string(line)
+		}
+		wg.Add(1)
+		go func(i int, cep string, ok bool) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result := BatchStreamResult{Index: i}
+			if ok {
+				result.BatchItemResult = h.lookupBatchItem(ctx, i, cep)
+			} else {
+				result.BatchItemResult = BatchItemResult{Cep: cep}.failed(ctx,
+					problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidZipcode, i18n.Sprintf(ctx, "invalid zipcode")))
+			}
+			select {
+			case out <- result:
+			case <-ctx.Done():
+			}
+		}(index, cep, ok)
+		index++
+	}
+	if ctx.Err() != nil {
+		// reading a body whose client went away fails, that is not a bad batch
+		return index, nil
+	}
+	return index, scanner.Err()
+}
+
+// streamReadProblem describes err, which stopped the reading of a batch
+func streamReadProblem(ctx context.Context, err error) *problem.Problem {
+	if errors.Is(err, bufio.ErrTooLong) {
+		return problem.New(http.StatusRequestEntityTooLarge, problem.CodeBatchTooLarge,
+			i18n.Sprintf(ctx, "batch line longer than %d bytes", maxStreamLine))
+	}
+	return problem.New(http.StatusBadRequest, problem.CodeInvalidBatch, i18n.Sprintf(ctx, "could not read the batch"))
+}
+
+// parseStreamCep reads the CEP of an NDJSON line, a JSON string or {"cep": "..."}
+func parseStreamCep(line []byte) (string, bool) {
+	var cep string
+	if err := json.Unmarshal(line, &cep); err == nil {
+		return cep, true
+	}
+	var request map[string]string
+	if err := json.Unmarshal(line, &request); err == nil && request["cep"] != "" {
+		return request["cep"], true
+	}
+	return "", false
+}
@@ -0,0 +1,172 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"servico_a/internal/problem"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestHandleBatchStream(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]string
+		json.NewDecoder(r.Body).Decode(&request)
+		if request["cep"] == "00000000" {
+			w.Header().Set("Content-Type", problem.ContentType)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(notFoundProblem))
+			return
+		}
+		fmt.Fprintf(w, `{"city": "Cidade %s"}`, request["cep"])
+	}))
+	defer serverMock.Close()
+
+	serviceData := &ServiceData{
+		ExternalCallURL:  serverMock.URL,
+		BatchConcurrency: 2,
+		RequestNameOTEL:  "microservice-tracer-mock",
+		OTELTracer:       sdktrace.NewTracerProvider().Tracer("test"),
+	}
+	server := httptest.NewServer(NewServer(serviceData).CreateServer())
+	defer server.Close()
+
+	body := "\"01001000\"\n{\"cep\": \"00000000\"}\n\nnot json\n\"07096240\"\n"
+	resp, err := http.Post(server.URL+"/batch", "application/x-ndjson", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	results := map[int]BatchStreamResult{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var result BatchStreamResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		results[result.Index] = result
+	}
+
+	assert.Len(t, results, 4)
+	assert.Equal(t, "01001000", results[0].Cep)
+	assert.Equal(t, http.StatusOK, results[0].Status)
+	assert.JSONEq(t, `{"city": "Cidade 01001000"}`, string(results[0].Result))
+	assert.Equal(t, http.StatusNotFound, results[1].Status)
+	assert.Equal(t, http.StatusUnprocessableEntity, results[2].Status)
+	assert.Equal(t, "not json", results[2].Cep)
+	assert.Equal(t, "07096240", results[3].Cep)
+	assert.NotEmpty(t, results[0].TraceID)
+	assert.NotEqual(t, results[0].TraceID, results[3].TraceID)
+}
+
+func TestHandleBatchStreamStopsWhenClientCancels(t *testing.T) {
+	var calls, inFlight int32
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+
+		var request map[string]string
+		json.NewDecoder(r.Body).Decode(&request)
+		if request["cep"] != "01001000" {
+			// segura os demais CEPs até o cancelamento chegar
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(`{"city": "São Paulo"}`))
+	}))
+	defer serverMock.Close()
+
+	serviceData := &ServiceData{
+		ExternalCallURL:  serverMock.URL,
+		BatchConcurrency: 2,
+		RequestNameOTEL:  "microservice-tracer-mock",
+		OTELTracer:       sdktrace.NewTracerProvider().Tracer("test"),
+	}
+	server := httptest.NewServer(NewServer(serviceData).CreateServer())
+	defer server.Close()
+
+	var body strings.Builder
+	body.WriteString("\"01001000\"\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&body, "\"%08d\"\n", 20000000+i)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "POST", server.URL+"/batch", strings.NewReader(body.String()))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	line, err := bufio.NewReader(resp.Body).ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first BatchStreamResult
+	json.Unmarshal(line, &first)
+	assert.Equal(t, "01001000", first.Cep)
+	cancel()
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&inFlight) == 0 }, 2*time.Second, 10*time.Millisecond)
+	assert.Less(t, atomic.LoadInt32(&calls), int32(10))
+}
+
+func TestHandleBatchStreamLineTooLong(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"city": "São Paulo"}`))
+	}))
+	defer serverMock.Close()
+
+	serviceData := &ServiceData{
+		ExternalCallURL: serverMock.URL,
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      sdktrace.NewTracerProvider().Tracer("test"),
+	}
+	server := httptest.NewServer(NewServer(serviceData).CreateServer())
+	defer server.Close()
+
+	body := "\"01001000\"\n\"" + strings.Repeat("0", maxStreamLine) + "\"\n\"07096240\"\n"
+	resp, err := http.Post(server.URL+"/batch", "application/x-ndjson", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var results []BatchStreamResult
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var result BatchStreamResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result)
+	}
+
+	// o 200 já foi enviado, então a leitura interrompida vira a última linha
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, results, 2)
+	assert.Equal(t, "01001000", results[0].Cep)
+	last := results[1]
+	assert.Equal(t, 1, last.Index)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, last.Status)
+	var p problem.Problem
+	assert.NoError(t, json.Unmarshal(last.Error, &p))
+	assert.Equal(t, problem.CodeBatchTooLarge, p.Code)
+}
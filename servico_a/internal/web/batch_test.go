@@ -0,0 +1,125 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"servico_a/internal/problem"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHandleBatch(t *testing.T) {
+	var inFlight, maxInFlight int32
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		var request map[string]string
+		json.NewDecoder(r.Body).Decode(&request)
+		if request["cep"] == "00000000" {
+			w.Header().Set("Content-Type", problem.ContentType)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(notFoundProblem))
+			return
+		}
+		fmt.Fprintf(w, `{"city": "Cidade %s", "temp_C": 20}`, request["cep"])
+	}))
+	defer serverMock.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	serviceData := &ServiceData{
+		ExternalCallURL:  serverMock.URL,
+		BatchConcurrency: 2,
+		RequestNameOTEL:  "microservice-tracer-mock",
+		OTELTracer:       tracer,
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	ceps := []string{"01001000", "00000000", "abc", "07096240", "20040002", "30130010"}
+	reqBody, _ := json.Marshal(ceps)
+	req, err := http.NewRequest("POST", "/batch", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp []BatchItemResult
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, resp, len(ceps))
+	for i, item := range resp {
+		assert.Equal(t, ceps[i], item.Cep)
+	}
+	assert.Equal(t, http.StatusOK, resp[0].Status)
+	assert.JSONEq(t, `{"city": "Cidade 01001000", "temp_C": 20}`, string(resp[0].Result))
+	assert.Equal(t, http.StatusNotFound, resp[1].Status)
+	assert.JSONEq(t, notFoundProblem, string(resp[1].Error))
+	assert.Equal(t, http.StatusUnprocessableEntity, resp[2].Status)
+	assert.Empty(t, resp[2].Result)
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxInFlight), int32(2))
+
+	var batchSpan sdktrace.ReadOnlySpan
+	var items []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		switch {
+		case span.Name() == "Lotemicroservice-tracer-mock":
+			batchSpan = span
+		case span.SpanKind() != trace.SpanKindClient:
+			items = append(items, span)
+		}
+	}
+	assert.NotNil(t, batchSpan)
+	assert.Len(t, items, len(ceps))
+	for _, item := range items {
+		assert.Len(t, item.Links(), 1)
+		assert.Equal(t, batchSpan.SpanContext().SpanID(), item.Links()[0].SpanContext.SpanID())
+		assert.NotEqual(t, batchSpan.SpanContext().TraceID(), item.SpanContext().TraceID())
+	}
+}
+
+func TestHandleBatchTooLarge(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("servico B should not be called")
+	}))
+	defer serverMock.Close()
+
+	serviceData := &ServiceData{
+		ExternalCallURL: serverMock.URL,
+		BatchMaxSize:    2,
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      sdktrace.NewTracerProvider().Tracer("test"),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	for body, status := range map[string]int{
+		`["01001000", "07096240", "20040002"]`: http.StatusRequestEntityTooLarge,
+		`{"cep": "01001000"}`:                  http.StatusUnprocessableEntity,
+	} {
+		req, _ := http.NewRequest("POST", "/batch", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, status, w.Code, body)
+	}
+}
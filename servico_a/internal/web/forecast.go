@@ -0,0 +1,39 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"servico_a/internal/i18n"
+	"servico_a/internal/problem"
+	"servico_a/internal/tracing"
+)
+
+// MaxForecastDays is the longest forecast a client can ask for
+const MaxForecastDays = 14
+
+type ForecastRequest struct {
+	Cep  string `json:"cep"`
+	Days int    `json:"days"`
+}
+
+// HandleForecast validates a forecast request and forwards it to servico B
+func (h *Webserver) HandleForecast(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServer(h.ServiceData.OTELTracer, w, r, "Previsao"+h.ServiceData.RequestNameOTEL)
+	defer span.End()
+	w = span.Writer
+
+	var request ForecastRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || len(request.Cep) != 8 {
+		h.rejectRequest(ctx, w, "cep", problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidZipcode, i18n.Sprintf(ctx, "invalid zipcode")))
+		return
+	}
+	span.SetAttributes(tracing.Cep(request.Cep, h.ServiceData.CepHashKey))
+	if request.Days < 1 || request.Days > MaxForecastDays {
+		h.rejectRequest(ctx, w, "days", problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidDays,
+			i18n.Sprintf(ctx, "days must be between 1 and %d", MaxForecastDays)))
+		return
+	}
+
+	h.forward(ctx, w, "/forecast", request)
+}
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestHandleForecast(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var received ForecastRequest
+	var traceparent string
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/forecast", r.URL.Path)
+		traceparent = r.Header.Get("traceparent")
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{"city": "Guarulhos", "days": [{"date": "2024-07-01", "min_temp_C": 15, "max_temp_C": 25, "min_temp_F": 59, "max_temp_F": 77, "min_temp_K": 288, "max_temp_K": 298, "condition": "Sunny"}]}`))
+	}))
+	defer serverMock.Close()
+
+	serviceData := &ServiceData{
+		ExternalCallURL: serverMock.URL + "/",
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      otel.Tracer("microservice-tracer-mock"),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	reqBody, _ := json.Marshal(ForecastRequest{Cep: "07096240", Days: 1})
+	req, err := http.NewRequest("POST", "/forecast", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp struct {
+		City string `json:"city"`
+		Days []struct {
+			MaxTemp_k float64 `json:"max_temp_K"`
+			Condition string  `json:"condition"`
+		} `json:"days"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ForecastRequest{Cep: "07096240", Days: 1}, received)
+	assert.Contains(t, traceparent, "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Equal(t, "Guarulhos", resp.City)
+	assert.Equal(t, 298.0, resp.Days[0].MaxTemp_k)
+	assert.Equal(t, "Sunny", resp.Days[0].Condition)
+}
+
+func TestHandleForecastInvalidRequest(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("servico B should not be called")
+	}))
+	defer serverMock.Close()
+
+	serviceData := &ServiceData{
+		ExternalCallURL: serverMock.URL,
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      otel.Tracer("microservice-tracer-mock"),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	for _, request := range []ForecastRequest{
+		{Cep: "abvc", Days: 3},
+		{Cep: "07096240", Days: 0},
+		{Cep: "07096240", Days: MaxForecastDays + 1},
+	} {
+		reqBody, _ := json.Marshal(request)
+		req, _ := http.NewRequest("POST", "/forecast", bytes.NewBuffer(reqBody))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, request)
+	}
+}
@@ -0,0 +1,66 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"servico_a/internal/i18n"
+	"servico_a/internal/problem"
+	"servico_a/internal/tracing"
+	"time"
+)
+
+const (
+	// MaxHistoryDays is the longest date range a client can ask for
+	MaxHistoryDays = 31
+
+	dateLayout = "2006-01-02"
+)
+
+type HistoryRequest struct {
+	Cep   string `json:"cep"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// validateDateRange checks for an inclusive range of past days, at most MaxHistoryDays long
+func validateDateRange(start, end string, today time.Time) error {
+	from, err := time.Parse(dateLayout, start)
+	if err != nil {
+		return i18n.Errorf("invalid start date")
+	}
+	to, err := time.Parse(dateLayout, end)
+	if err != nil {
+		return i18n.Errorf("invalid end date")
+	}
+	if to.Before(from) {
+		return i18n.Errorf("end date before start date")
+	}
+	if to.Format(dateLayout) > today.Format(dateLayout) {
+		return i18n.Errorf("dates must not be in the future")
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > MaxHistoryDays {
+		return i18n.Errorf("date range too long")
+	}
+	return nil
+}
+
+// HandleHistory validates a history request and forwards it to servico B
+func (h *Webserver) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServer(h.ServiceData.OTELTracer, w, r, "Historico"+h.ServiceData.RequestNameOTEL)
+	defer span.End()
+	w = span.Writer
+
+	var request HistoryRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || len(request.Cep) != 8 {
+		h.rejectRequest(ctx, w, "cep", problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidZipcode, i18n.Sprintf(ctx, "invalid zipcode")))
+		return
+	}
+	span.SetAttributes(tracing.Cep(request.Cep, h.ServiceData.CepHashKey))
+	if err := validateDateRange(request.Start, request.End, time.Now()); err != nil {
+		h.rejectRequest(ctx, w, "date_range", problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidDateRange, i18n.Message(ctx, err)))
+		return
+	}
+
+	h.forward(ctx, w, "/history", request)
+}
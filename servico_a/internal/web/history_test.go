@@ -0,0 +1,82 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+)
+
+func TestValidateDateRange(t *testing.T) {
+	today := time.Date(2024, 7, 10, 15, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, validateDateRange("2024-07-01", "2024-07-10", today))
+	assert.NoError(t, validateDateRange("2024-06-10", "2024-07-10", today))
+
+	for _, dates := range [][2]string{
+		{"01/07/2024", "2024-07-02"},
+		{"2024-07-01", ""},
+		{"2024-07-05", "2024-07-01"},
+		{"2024-07-01", "2024-07-11"},
+		{"2024-06-09", "2024-07-10"},
+	} {
+		assert.Error(t, validateDateRange(dates[0], dates[1], today), dates)
+	}
+}
+
+func TestHandleHistory(t *testing.T) {
+	var received HistoryRequest
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/history", r.URL.Path)
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{"city": "Guarulhos", "days": [{"date": "2024-07-01", "min_temp_C": 20, "max_temp_C": 30}]}`))
+	}))
+	defer serverMock.Close()
+
+	serviceData := &ServiceData{
+		ExternalCallURL: serverMock.URL,
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      otel.Tracer("microservice-tracer-mock"),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	request := HistoryRequest{Cep: "07096240", Start: "2024-07-01", End: "2024-07-01"}
+	reqBody, _ := json.Marshal(request)
+	req, err := http.NewRequest("POST", "/history", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, request, received)
+	assert.Contains(t, w.Body.String(), "Guarulhos")
+}
+
+func TestHandleHistoryInvalidRange(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("servico B should not be called")
+	}))
+	defer serverMock.Close()
+
+	serviceData := &ServiceData{
+		ExternalCallURL: serverMock.URL,
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      otel.Tracer("microservice-tracer-mock"),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	reqBody, _ := json.Marshal(HistoryRequest{Cep: "07096240", Start: "2024-01-01", End: "2024-03-01"})
+	req, _ := http.NewRequest("POST", "/history", bytes.NewBuffer(reqBody))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "date range too long")
+}
@@ -2,15 +2,27 @@ package web
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"servico_a/internal/breaker"
+	"servico_a/internal/httpclient"
+	"servico_a/internal/i18n"
+	"servico_a/internal/identity"
+	"servico_a/internal/logging"
+	"servico_a/internal/metrics"
+	"servico_a/internal/problem"
+	"servico_a/internal/tracing"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -28,15 +40,27 @@ func NewServer(serviceData *ServiceData) *Webserver {
 // createServer creates a new server instance with go chi router
 func (we *Webserver) CreateServer() *chi.Mux {
 	router := chi.NewRouter()
+	router.NotFound(notFound)
+	router.MethodNotAllowed(methodNotAllowed(router))
 
 	router.Use(middleware.RequestID)
 	router.Use(middleware.RealIP)
-	router.Use(middleware.Recoverer)
-	router.Use(middleware.Logger)
-	router.Use(middleware.Timeout(60 * time.Second))
-	// promhttp
-	// router.Handle("/metrics", promhttp.Handler())
-	router.Post("/", we.HandleRequest)
+	router.Use(we.ServiceData.Metrics.Middleware)
+	router.Use(i18n.Middleware)
+	router.Use(recoverer)
+	router.Use(logging.Middleware)
+	router.Use(identity.Middleware(we.ServiceData.Clients, we.ServiceData.Channels))
+	if we.ServiceData.MetricsHandler != nil {
+		router.Handle("/metrics", we.ServiceData.MetricsHandler)
+	}
+	router.Group(func(r chi.Router) {
+		r.Use(timeout(60 * time.Second))
+		r.Post("/", we.HandleRequest)
+		r.Post("/forecast", we.HandleForecast)
+		r.Post("/history", we.HandleHistory)
+	})
+	// lotes grandes podem levar minutos, ficam limitados apenas pelo cliente
+	router.Post("/batch", we.HandleBatch)
 	return router
 }
 
@@ -44,57 +68,267 @@ type ServiceData struct {
 	Title              string
 	ExternalCallMethod string
 	ExternalCallURL    string
-	RequestNameOTEL    string
-	OTELTracer         trace.Tracer
+	BatchConcurrency   int
+	BatchMaxSize       int
+	Breaker            *breaker.Breaker
+	// Client sends the calls to servico B, httpclient.Default when nil
+	Client          *http.Client
+	RequestNameOTEL string
+	OTELTracer      trace.Tracer
+	// CepHashKey, when set, hashes the CEP in the span attributes, see tracing.Cep
+	CepHashKey []byte
+	// Metrics gets the request, servico B call and CEP lookup measurements,
+	// nothing is recorded when nil
+	Metrics *metrics.Metrics
+	// Clients are the clients known by api key, sent on to servico B in the
+	// baggage along with the request channel, one of Channels
+	Clients  identity.Clients
+	Channels []string
+	// MetricsHandler serves /metrics on the router, left nil when the metrics
+	// are off or served on the admin port
+	MetricsHandler http.Handler
 }
 
 func (h *Webserver) HandleRequest(w http.ResponseWriter, r *http.Request) {
-	carrier := propagation.HeaderCarrier(r.Header)
-	ctx := r.Context()
-	ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
-
-	ctx, span := h.ServiceData.OTELTracer.Start(ctx, "Chamada externa"+h.ServiceData.RequestNameOTEL)
+	ctx, span := tracing.StartServer(h.ServiceData.OTELTracer, w, r, "Chamada externa"+h.ServiceData.RequestNameOTEL)
 	defer span.End()
+	w = span.Writer
 
 	var request map[string]string
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil || len(request["cep"]) != 8 {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		json.NewEncoder(w).Encode(map[string]string{"message": "invalid zipcode"})
+		h.rejectRequest(ctx, w, "cep", problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidZipcode, i18n.Sprintf(ctx, "invalid zipcode")))
 		return
 	}
+	span.SetAttributes(tracing.Cep(request["cep"], h.ServiceData.CepHashKey))
 
-	// Encaminhar para o Serviço B
-	var req *http.Request
-	reqBody, err := json.Marshal(request)
+	// Encaminhar para o Serviço B, junto com os campos pedidos em ?detail e ?fields
+	path := ""
+	if r.URL.RawQuery != "" {
+		path = "/?" + r.URL.RawQuery
+	}
+	h.forward(ctx, w, path, request)
+}
+
+// forward sends payload to path on servico B and copies its answer back to w
+func (h *Webserver) forward(ctx context.Context, w http.ResponseWriter, path string, payload interface{}) {
+	resp, err := h.callServiceB(ctx, path, payload)
 	if err != nil {
-		http.Error(w, "error in the body", http.StatusInternalServerError)
+		tracing.RecordError(trace.SpanFromContext(ctx), err)
+		problem.Write(ctx, w, callProblem(ctx, err))
 		return
 	}
-	req, err = http.NewRequestWithContext(ctx, h.ServiceData.ExternalCallMethod, h.ServiceData.ExternalCallURL, bytes.NewBuffer(reqBody))
-	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
-	resp, err := http.DefaultClient.Do(req)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, "Could not complete the request", http.StatusInternalServerError)
+		tracing.RecordError(trace.SpanFromContext(ctx), err)
+		problem.Write(ctx, w, callProblem(ctx, err))
 		return
 	}
-	defer resp.Body.Close()
+
+	// repassa os avisos de cache vencido do servico B
+	for _, warning := range resp.Header.Values("Warning") {
+		w.Header().Add("Warning", warning)
+		if strings.HasPrefix(warning, "110 ") {
+			trace.SpanFromContext(ctx).SetAttributes(tracing.WeatherCacheStatusKey.String("stale"))
+		}
+	}
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := ioutil.ReadAll(resp.Body)
-		w.Header().Set("Content-Type", "application/json")
+		h.ServiceData.Metrics.RecordCepLookup(ctx, lookupOutcome(resp.StatusCode, body))
+		w.Header().Set("Content-Type", problem.ContentType)
 		w.WriteHeader(resp.StatusCode)
-		w.Write(body)
+		w.Write(serviceBProblem(ctx, resp, body))
 		return
 	}
+	trace.SpanFromContext(ctx).SetAttributes(answerAttributes(body)...)
+	h.ServiceData.Metrics.RecordCepLookup(ctx, metrics.CepFound)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// serviceBAnswer holds the fields of a servico B answer that become span
+// attributes, the temperatures are only in current weather answers
+type serviceBAnswer struct {
+	City            string   `json:"city"`
+	State           string   `json:"state"`
+	CepProvider     string   `json:"cep_provider"`
+	WeatherProvider string   `json:"weather_provider"`
+	TempC           *float64 `json:"temp_C"`
+	TempF           *float64 `json:"temp_F"`
+	TempK           *float64 `json:"temp_K"`
+}
+
+// answerAttributes reads the resolved locality, the providers and the
+// temperatures from a servico B answer
+func answerAttributes(body []byte) []attribute.KeyValue {
+	var answer serviceBAnswer
+	if err := json.Unmarshal(body, &answer); err != nil {
+		return nil
+	}
+	attrs := []attribute.KeyValue{
+		tracing.LocalityKey.String(answer.City),
+		tracing.StateKey.String(answer.State),
+		tracing.CepProviderKey.String(answer.CepProvider),
+		tracing.WeatherProviderKey.String(answer.WeatherProvider),
+	}
+	if answer.TempC != nil && answer.TempF != nil && answer.TempK != nil {
+		attrs = append(attrs,
+			tracing.TempCKey.Float64(*answer.TempC),
+			tracing.TempFKey.Float64(*answer.TempF),
+			tracing.TempKKey.Float64(*answer.TempK),
+		)
+	}
+	return attrs
+}
+
+// rejectRequest answers p to a request that failed validation, recording on
+// the request span which field was refused
+func (h *Webserver) rejectRequest(ctx context.Context, w http.ResponseWriter, field string, p *problem.Problem) {
+	if field == "cep" {
+		h.ServiceData.Metrics.RecordCepLookup(ctx, metrics.CepInvalid)
+	}
+	trace.SpanFromContext(ctx).AddEvent(tracing.ValidationFailedEvent, trace.WithAttributes(
+		attribute.String("validation.field", field),
+		attribute.String("problem.code", p.Code),
+	))
+	problem.Write(ctx, w, p)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+func init() {
+	tracing.RegisterError(breaker.ErrOpen, "circuit_open", false)
+}
+
+// callProblem describes a call to servico B that got no answer
+func callProblem(ctx context.Context, err error) *problem.Problem {
+	if errors.Is(err, breaker.ErrOpen) {
+		return problem.New(http.StatusServiceUnavailable, problem.CodeServiceBUnavailable,
+			i18n.Sprintf(ctx, "servico B is unavailable, try again later"))
+	}
+	return problem.New(http.StatusBadGateway, problem.CodeServiceBUnreachable, i18n.Sprintf(ctx, "could not reach servico B"))
+}
+
+// serviceBProblem returns the problem document servico B answered with as is,
+// wrapping any other error answer into one
+func serviceBProblem(ctx context.Context, resp *http.Response, body []byte) []byte {
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == problem.ContentType {
+		return body
+	}
+	return problem.Marshal(ctx, problem.New(resp.StatusCode, problem.CodeInvalidServiceBAnswer, strings.TrimSpace(string(body))))
+}
+
+// lookupOutcome is the CEP lookup outcome of a servico B error answer, told by
+// the code of its problem: the weather failing for a CEP that was found is not
+// a failed lookup, and an invalid parameter other than the CEP means no lookup
+// at all. Answers without a problem fall back on their status.
+func lookupOutcome(status int, body []byte) string {
+	switch problem.CodeOf(body) {
+	case problem.CodeZipcodeNotFound:
+		return metrics.CepNotFound
+	case problem.CodeInvalidZipcode:
+		return metrics.CepInvalid
+	case problem.CodeWeatherLookupFailed:
+		return metrics.CepFound
+	case problem.CodeInvalidDays, problem.CodeInvalidDateRange, problem.CodeInvalidFields:
+		return ""
+	}
+	switch status {
+	case http.StatusNotFound:
+		return metrics.CepNotFound
+	case http.StatusUnprocessableEntity:
+		return metrics.CepInvalid
+	default:
+		return metrics.CepError
+	}
+}
+
+// callOutcome tells how a call to servico B went, for the upstream metrics
+func callOutcome(resp *http.Response, err error) string {
+	switch {
+	case err == nil && resp.StatusCode < http.StatusInternalServerError:
+		return "success"
+	case errors.Is(err, breaker.ErrOpen):
+		return "circuit_open"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+// serviceBFailed tells whether a servico B error answer shows servico B itself
+// failing, and so counts against its breaker. It is told by the code of the
+// problem, as in lookupOutcome: servico B timing out does, while its other
+// problems are about the request or the providers behind it, which have
+// breakers of their own, as 500 weather_lookup_failed for a locality with no
+// weather or 503 upstream_unavailable. Answers without a problem come from a
+// gateway in front of servico B and count when they are 502 or 504.
+func serviceBFailed(status int, body []byte) bool {
+	switch problem.CodeOf(body) {
+	case problem.CodeTimeout:
+		return true
+	case "":
+		return status == http.StatusBadGateway || status == http.StatusGatewayTimeout
+	default:
+		return false
+	}
+}
+
+// callServiceB sends payload to path on servico B through its circuit breaker.
+// Transport errors, timeouts and the answers told by serviceBFailed count
+// against the breaker, but the answer is still returned so it can be passed on.
+func (h *Webserver) callServiceB(ctx context.Context, path string, payload interface{}) (resp *http.Response, err error) {
+	start := time.Now()
+	defer func() {
+		h.ServiceData.Metrics.RecordServiceB(ctx, callOutcome(resp, err), time.Since(start))
+	}()
+
+	if h.ServiceData.Breaker == nil {
+		return h.sendServiceB(ctx, path, payload)
+	}
+	err = h.ServiceData.Breaker.Do(ctx, func(ctx context.Context) (err error) {
+		resp, err = h.sendServiceB(ctx, path, payload)
+		if err != nil || resp.StatusCode < http.StatusInternalServerError {
+			return err
+		}
+		// as respostas de erro são pequenas, lidas aqui para serem classificadas
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			resp = nil
+			return err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if serviceBFailed(resp.StatusCode, body) {
+			return fmt.Errorf("servico B answered %d", resp.StatusCode)
+		}
+		return nil
+	})
+	if resp != nil {
+		return resp, nil
+	}
+	return nil, err
+}
+
+// sendServiceB sends payload to path on servico B, continuing the trace in ctx
+func (h *Webserver) sendServiceB(ctx context.Context, path string, payload interface{}) (*http.Response, error) {
+	reqBody, err := json.Marshal(payload)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(body)
+	endpoint := h.ServiceData.ExternalCallURL
+	if path != "" {
+		endpoint = strings.TrimSuffix(endpoint, "/") + path
+	}
+	req, err := http.NewRequestWithContext(ctx, h.ServiceData.ExternalCallMethod, endpoint, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept-Language", i18n.FromContext(ctx).String())
+	client := h.ServiceData.Client
+	if client == nil {
+		client = httpclient.Default
+	}
+	return client.Do(req)
 }
@@ -6,10 +6,25 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"servico_a/internal/breaker"
+	"servico_a/internal/httpclient"
+	"servico_a/internal/identity"
+	"servico_a/internal/metrics"
+	"servico_a/internal/problem"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestHandler(t *testing.T) {
@@ -60,10 +75,14 @@ func TestHandler(t *testing.T) {
 	assert.Equal(t, 300.8, resp.Temp_k)
 }
 
+// notFoundProblem is what servico B answers for an unknown CEP
+const notFoundProblem = `{"type": "about:blank", "title": "Not Found", "status": 404, "detail": "can not find zip code", "code": "zipcode_not_found", "trace_id": "4bf92f3577b34da6a3ce929d0e0e4736"}`
+
 func TestHandlerZipCodeNotFound(t *testing.T) {
 	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", problem.ContentType)
 		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(`{"message": "can not find zip code"}`))
+		w.Write([]byte(notFoundProblem))
 	}))
 	defer serverMock.Close()
 
@@ -103,12 +122,14 @@ func TestHandlerZipCodeNotFound(t *testing.T) {
 
 	assert.Equal(t, http.StatusNotFound, w.Code)
 	assert.Empty(t, resp)
+	// o problem do servico B é repassado sem mudanças
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, notFoundProblem, w.Body.String())
 }
 
 func TestHandlerInvalidZipCode(t *testing.T) {
 	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		w.Write([]byte(`{"message": "invalid zipcode"}`))
+		t.Error("servico B should not be called")
 	}))
 	defer serverMock.Close()
 
@@ -145,4 +166,375 @@ func TestHandlerInvalidZipCode(t *testing.T) {
 	}
 	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
 	assert.Empty(t, resp)
+
+	var p problem.Problem
+	json.Unmarshal(w.Body.Bytes(), &p)
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusUnprocessableEntity, p.Status)
+	assert.Equal(t, problem.CodeInvalidZipcode, p.Code)
+}
+
+func TestHandlerForwardsStaleWarning(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Warning", `110 - "Response is Stale"`)
+		w.Header().Add("Warning", `111 - "Revalidation Failed"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"city": "São Paulo", "temp_C": 27.8, "temp_F": 82, "temp_K": 300.8}`))
+	}))
+	defer serverMock.Close()
+
+	tracer := otel.Tracer("microservice-tracer-mock")
+
+	serviceData := &ServiceData{
+		ExternalCallURL: serverMock.URL,
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      tracer,
+	}
+
+	server := NewServer(serviceData)
+	router := server.CreateServer()
+
+	reqBody, _ := json.Marshal(map[string]string{"cep": "07096240"})
+	req, err := http.NewRequest("POST", "/", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{`110 - "Response is Stale"`, `111 - "Revalidation Failed"`}, w.Header().Values("Warning"))
+}
+
+func TestHandlerBreakerOpen(t *testing.T) {
+	var calls int32
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer serverMock.Close()
+
+	b, err := breaker.New("servico_b", breaker.Settings{FailureThreshold: 2, OpenTimeout: time.Minute}, otel.Meter("microservice-meter-mock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceData := &ServiceData{
+		ExternalCallURL: serverMock.URL,
+		Breaker:         b,
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      otel.Tracer("microservice-tracer-mock"),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	// as respostas 502 do gateway do servico B são repassadas até o breaker abrir
+	for _, expected := range []struct {
+		status int
+		code   string
+	}{
+		{http.StatusBadGateway, problem.CodeInvalidServiceBAnswer},
+		{http.StatusBadGateway, problem.CodeInvalidServiceBAnswer},
+		{http.StatusServiceUnavailable, problem.CodeServiceBUnavailable},
+	} {
+		req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(`{"cep": "01001000"}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, expected.status, w.Code)
+
+		var p problem.Problem
+		json.Unmarshal(w.Body.Bytes(), &p)
+		assert.Equal(t, expected.code, p.Code)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestHandlerBreakerIgnoresLookupProblems(t *testing.T) {
+	var calls int32
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		problem.Write(r.Context(), w, problem.New(http.StatusInternalServerError, problem.CodeWeatherLookupFailed, "no weather"))
+	}))
+	defer serverMock.Close()
+
+	b, err := breaker.New("servico_b", breaker.Settings{FailureThreshold: 2, OpenTimeout: time.Minute}, otel.Meter("microservice-meter-mock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceData := &ServiceData{
+		ExternalCallURL: serverMock.URL,
+		Breaker:         b,
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      otel.Tracer("microservice-tracer-mock"),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	// o servico B respondeu, só não achou o clima daquela localidade
+	for i := 0; i < 5; i++ {
+		req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(`{"cep": "01001000"}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+		var p problem.Problem
+		json.Unmarshal(w.Body.Bytes(), &p)
+		assert.Equal(t, problem.CodeWeatherLookupFailed, p.Code)
+	}
+	assert.Equal(t, int32(5), atomic.LoadInt32(&calls))
+	assert.Equal(t, breaker.Closed, b.State())
+}
+
+func TestServiceBFailed(t *testing.T) {
+	for _, test := range []struct {
+		status int
+		body   string
+		failed bool
+	}{
+		{http.StatusInternalServerError, `{"code": "weather_lookup_failed"}`, false},
+		{http.StatusServiceUnavailable, `{"code": "upstream_unavailable"}`, false},
+		{http.StatusInternalServerError, `{"code": "internal_error"}`, false},
+		{http.StatusGatewayTimeout, `{"code": "timeout"}`, true},
+		{http.StatusBadGateway, "bad gateway", true},
+		{http.StatusGatewayTimeout, "", true},
+		{http.StatusInternalServerError, "internal error", false},
+	} {
+		assert.Equal(t, test.failed, serviceBFailed(test.status, []byte(test.body)), test.body)
+	}
+}
+
+func TestHandlerForwardsFields(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/", r.URL.Path)
+		assert.Equal(t, "humidity,wind", r.URL.Query().Get("fields"))
+		w.Write([]byte(`{"city": "São Paulo", "temp_C": 27.8, "humidity": 60}`))
+	}))
+	defer serverMock.Close()
+
+	serviceData := &ServiceData{
+		ExternalCallURL: serverMock.URL,
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      otel.Tracer("microservice-tracer-mock"),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	req, _ := http.NewRequest("POST", "/?fields=humidity,wind", bytes.NewBufferString(`{"cep": "01001000"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"city": "São Paulo", "temp_C": 27.8, "humidity": 60}`, w.Body.String())
+}
+
+func TestHandlerForwardsLanguage(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// o serviço B recebe o idioma já negociado, não o header original
+		assert.Equal(t, "pt-BR", r.Header.Get("Accept-Language"))
+		w.Write([]byte(`{"city": "São Paulo", "temp_C": 27.8}`))
+	}))
+	defer serverMock.Close()
+
+	serviceData := &ServiceData{
+		ExternalCallURL: serverMock.URL,
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      otel.Tracer("microservice-tracer-mock"),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	post := func(cep string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(`{"cep": "`+cep+`"}`))
+		req.Header.Set("Accept-Language", "pt;q=0.9,fr;q=0.5")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("01001000")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "pt-BR", w.Header().Get("Content-Language"))
+
+	w = post("123")
+	var p problem.Problem
+	json.Unmarshal(w.Body.Bytes(), &p)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, problem.CodeInvalidZipcode, p.Code)
+	assert.Equal(t, "cep inválido", p.Detail)
+}
+
+func TestHandlerSpanStatus(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gateway timeout", http.StatusGatewayTimeout)
+	}))
+	defer serverMock.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("microservice-tracer-mock")
+	b, err := breaker.New("servico_b", breaker.Settings{FailureThreshold: 1, OpenTimeout: time.Minute}, otel.Meter("microservice-meter-mock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceData := &ServiceData{
+		ExternalCallURL: serverMock.URL,
+		Breaker:         b,
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      tracer,
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	for _, body := range []string{`{"cep": "123"}`, `{"cep": "01001000"}`, `{"cep": "01001000"}`} {
+		req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(body))
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var spans []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() == trace.SpanKindServer {
+			spans = append(spans, span)
+		}
+	}
+	assert.Len(t, spans, 3)
+
+	// cep inválido é erro do cliente, o span não falha
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Contains(t, spans[0].Attributes(), attribute.Int("http.response.status_code", http.StatusUnprocessableEntity))
+
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Contains(t, spans[1].Attributes(), attribute.Int("http.response.status_code", http.StatusGatewayTimeout))
+
+	// com o breaker aberto o erro é gravado com sua classificação
+	assert.Equal(t, codes.Error, spans[2].Status().Code)
+	assert.Contains(t, spans[2].Attributes(), attribute.Int("http.response.status_code", http.StatusServiceUnavailable))
+	assert.Len(t, spans[2].Events(), 1)
+	assert.Equal(t, "exception", spans[2].Events()[0].Name)
+	assert.Contains(t, spans[2].Events()[0].Attributes, attribute.String("error.type", "circuit_open"))
+}
+
+func TestHandlerSpanAttributes(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Warning", `110 - "Response is Stale"`)
+		w.Write([]byte(`{"city": "Guarulhos", "state": "SP", "temp_C": 25, "temp_F": 77, "temp_K": 298,
+			"cep_provider": "viacep", "weather_provider": "weatherapi"}`))
+	}))
+	defer serverMock.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	serviceData := &ServiceData{
+		ExternalCallURL: serverMock.URL,
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("microservice-tracer-mock"),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	requestSpan := func(body string) sdktrace.ReadOnlySpan {
+		req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(body))
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		spans := recorder.Ended()
+		return spans[len(spans)-1]
+	}
+
+	span := requestSpan(`{"cep": "07096240"}`)
+	for _, kv := range []attribute.KeyValue{
+		attribute.String("cep", "07096240"),
+		attribute.String("address.localidade", "Guarulhos"),
+		attribute.String("address.uf", "SP"),
+		attribute.String("cep.provider", "viacep"),
+		attribute.String("weather.provider", "weatherapi"),
+		attribute.String("weather.cache.status", "stale"),
+		attribute.Float64("weather.temp_c", 25),
+		attribute.Float64("weather.temp_f", 77),
+		attribute.Float64("weather.temp_k", 298),
+	} {
+		assert.Contains(t, span.Attributes(), kv)
+	}
+
+	// com a chave configurada o cep vai para o span como hash
+	serviceData.CepHashKey = []byte("chave")
+	span = requestSpan(`{"cep": "07096240"}`)
+	assert.NotContains(t, span.Attributes(), attribute.String("cep", "07096240"))
+
+	span = requestSpan(`{"cep": "123"}`)
+	assert.Len(t, span.Events(), 1)
+	assert.Equal(t, "validation failed", span.Events()[0].Name)
+	assert.Contains(t, span.Events()[0].Attributes, attribute.String("validation.field", "cep"))
+	assert.Contains(t, span.Events()[0].Attributes, attribute.String("problem.code", problem.CodeInvalidZipcode))
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	metricsHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "cep_lookups_total 1")
+	})
+
+	// sem handler, ou com /metrics na porta de administração, a rota não existe
+	for _, test := range []struct {
+		handler http.Handler
+		status  int
+	}{
+		{nil, http.StatusNotFound},
+		{metricsHandler, http.StatusOK},
+	} {
+		router := NewServer(&ServiceData{MetricsHandler: test.handler}).CreateServer()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.Equal(t, test.status, w.Code)
+	}
+}
+
+func TestHandlerForwardsIdentity(t *testing.T) {
+	var members map[string]string
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := baggage.Parse(r.Header.Get("Baggage"))
+		assert.NoError(t, err)
+		members = map[string]string{}
+		for _, m := range b.Members() {
+			members[m.Key()] = m.Value()
+		}
+		w.Write([]byte(`{"city": "São Paulo", "temp_C": 27.8}`))
+	}))
+	defer serverMock.Close()
+
+	serviceData := &ServiceData{
+		ExternalCallURL: serverMock.URL,
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      otel.Tracer("microservice-tracer-mock"),
+		Client: httpclient.New(otelhttp.WithPropagators(
+			propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+		)),
+		Clients:  identity.Clients{"k3y": {ID: "acme", Tenant: "retail"}},
+		Channels: identity.DefaultChannels,
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(`{"cep": "01001000"}`))
+	req.Header.Set(identity.APIKeyHeader, "k3y")
+	req.Header.Set(identity.ChannelHeader, "web")
+	// o baggage enviado pelo cliente não chega ao serviço B
+	req.Header.Set("Baggage", "client.id=evil")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]string{
+		identity.ClientIDKey: "acme",
+		identity.TenantKey:   "retail",
+		identity.ChannelKey:  "web",
+	}, members)
+}
+
+func TestLookupOutcome(t *testing.T) {
+	for _, test := range []struct {
+		status  int
+		body    string
+		outcome string
+	}{
+		{http.StatusNotFound, notFoundProblem, metrics.CepNotFound},
+		{http.StatusUnprocessableEntity, `{"status": 422, "code": "invalid_zipcode"}`, metrics.CepInvalid},
+		// o cep foi encontrado, quem falhou foi o tempo
+		{http.StatusInternalServerError, `{"status": 500, "code": "weather_lookup_failed"}`, metrics.CepFound},
+		{http.StatusServiceUnavailable, `{"status": 503, "code": "upstream_unavailable"}`, metrics.CepError},
+		// parâmetros inválidos além do cep: nenhum cep foi consultado
+		{http.StatusUnprocessableEntity, `{"status": 422, "code": "invalid_days"}`, ""},
+		{http.StatusUnprocessableEntity, `{"status": 422, "code": "invalid_fields"}`, ""},
+		// sem problem details, vale o status
+		{http.StatusNotFound, "not found", metrics.CepNotFound},
+		{http.StatusBadGateway, "bad gateway", metrics.CepError},
+	} {
+		assert.Equal(t, test.outcome, lookupOutcome(test.status, []byte(test.body)), test.body)
+	}
 }
@@ -2,28 +2,52 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"servico_b/internal/breaker"
+	"servico_b/internal/cache"
+	"servico_b/internal/httpclient"
+	"servico_b/internal/logging"
+	"servico_b/internal/metrics"
+	"servico_b/internal/provider"
+	"servico_b/internal/retry"
+	"servico_b/internal/secret"
+	"servico_b/internal/tracing"
 	"servico_b/internal/web"
+	"strings"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/spf13/viper"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func initProvider(serviceName, collectorURL string) (func(context.Context) error, error) {
+// initProvider sets up the tracer, meter and logger providers exporting to
+// the collector, the meter provider also read by readers, such as the
+// Prometheus one
+func initProvider(serviceName, collectorURL string, readers ...sdkmetric.Reader) (func(context.Context) error, error) {
 	ctx := context.Background()
 
 	res, err := resource.New(ctx,
@@ -50,66 +74,402 @@ func initProvider(serviceName, collectorURL string) (func(context.Context) error
 		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
 	}
 
-	bsp := sdktrace.NewBatchSpanProcessor(traceExporter)
+	// span attributes and recorded errors may quote upstream urls with api keys
+	// and CEPs, the cache keys CEPs too
+	exporter := secret.NewExporter(traceExporter)
+	exporter.Redact = redactor()
+	bsp := sdktrace.NewBatchSpanProcessor(exporter)
 	tracerProvider := sdktrace.NewTracerProvider(
 		sdktrace.WithSampler(sdktrace.AlwaysSample()),
 		sdktrace.WithResource(res),
+		sdktrace.WithSpanProcessor(tracing.NewBaggageProcessor(strings.Split(viper.GetString("BAGGAGE_SPAN_ATTRIBUTES"), ",")...)),
 		sdktrace.WithSpanProcessor(bsp),
 	)
 	otel.SetTracerProvider(tracerProvider)
 
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	metricExporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithGRPCConn(conn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+	}
+	options := []sdkmetric.Option{
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter,
+			sdkmetric.WithInterval(viper.GetDuration("OTEL_METRIC_EXPORT_INTERVAL")))),
+	}
+	for _, reader := range readers {
+		options = append(options, sdkmetric.WithReader(reader))
+	}
+	meterProvider := sdkmetric.NewMeterProvider(options...)
+	otel.SetMeterProvider(meterProvider)
+	if err := metrics.StartRuntime(meterProvider); err != nil {
+		return nil, fmt.Errorf("failed to start runtime metrics: %w", err)
+	}
+
+	logExporter, err := otlploggrpc.New(ctx, otlploggrpc.WithGRPCConn(conn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log exporter: %w", err)
+	}
+	loggerProvider := sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)),
+	)
+	global.SetLoggerProvider(loggerProvider)
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(ctx context.Context) error {
+		return errors.Join(tracerProvider.Shutdown(ctx), meterProvider.Shutdown(ctx), loggerProvider.Shutdown(ctx))
+	}, nil
+}
+
+// newCaches builds the CEP and weather caches on the backend chosen in CACHE_BACKEND
+func newCaches(tracer trace.Tracer) (cache.Cache, cache.Cache, error) {
+	switch backend := viper.GetString("CACHE_BACKEND"); backend {
+	case "memory":
+		cepCache := cache.NewMemory(viper.GetInt("CEP_CACHE_SIZE"))
+		weatherCache := cache.NewMemory(viper.GetInt("WEATHER_CACHE_SIZE"))
+		return cache.NewTraced(cepCache, backend, tracer), cache.NewTraced(weatherCache, backend, tracer), nil
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     viper.GetString("REDIS_ADDR"),
+			Password: viper.GetString("REDIS_PASSWORD"),
+			DB:       viper.GetInt("REDIS_DB"),
+		})
+		shared := cache.NewTraced(cache.NewRedis(client), backend, tracer)
+		return shared, shared, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown cache backend %q", backend)
+	}
+}
 
-	return tracerProvider.Shutdown, nil
+// upstreamSetting returns the key of the setting of the upstream name, which is
+// key prefixed by name when set, as in VIACEP_BREAKER_FAILURE_THRESHOLD, or
+// the key shared by every upstream otherwise
+func upstreamSetting(name, key string) string {
+	if prefixed := strings.ToUpper(name) + "_" + key; viper.IsSet(prefixed) {
+		return prefixed
+	}
+	return key
+}
+
+// newBreaker builds the circuit breaker of the upstream name
+func newBreaker(name string, meter metric.Meter) (*breaker.Breaker, error) {
+	return breaker.New(name, breaker.Settings{
+		FailureThreshold: viper.GetInt(upstreamSetting(name, "BREAKER_FAILURE_THRESHOLD")),
+		OpenTimeout:      viper.GetDuration(upstreamSetting(name, "BREAKER_OPEN_TIMEOUT")),
+	}, meter)
+}
+
+// newLimiter builds the rate limiter of the upstream name, nil when no
+// <NAME>_RATE_LIMIT is configured for it
+func newLimiter(name string) *provider.Limiter {
+	perMinute := viper.GetFloat64(strings.ToUpper(name) + "_RATE_LIMIT")
+	if perMinute <= 0 {
+		return nil
+	}
+	return provider.NewLimiter(name, perMinute,
+		viper.GetInt(upstreamSetting(name, "RATE_LIMIT_BURST")),
+		viper.GetDuration(upstreamSetting(name, "RATE_LIMIT_MAX_WAIT")),
+	)
+}
+
+// weatherAPIKeys loads the weatherapi keys from WEATHERAPI_KEY_FILE or
+// WEATHERAPI_KEY, returning them with the WEATHERURL template. A key left in
+// the template, as older configurations did, is moved out of it.
+func weatherAPIKeys() (string, *secret.Keyring, error) {
+	keys, err := secret.Load(viper.GetString("WEATHERAPI_KEY_FILE"), viper.GetString("WEATHERAPI_KEY"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	template := viper.GetString("WEATHERURL")
+	if base, query, found := strings.Cut(template, "?"); found {
+		var params []string
+		for _, param := range strings.Split(query, "&") {
+			if key, ok := strings.CutPrefix(param, "key="); ok {
+				slog.Warn("WEATHERURL carries an api key, move it to WEATHERAPI_KEY or WEATHERAPI_KEY_FILE")
+				if err := secret.Check(key); err != nil {
+					return "", nil, fmt.Errorf("WEATHERURL: %w", err)
+				}
+				secret.Register(key)
+				keys = append(keys, key)
+				continue
+			}
+			params = append(params, param)
+		}
+		template = base + "?" + strings.Join(params, "&")
+	}
+	return template, secret.NewKeyring(provider.WeatherAPIName, keys, viper.GetDuration("WEATHERAPI_KEY_COOLDOWN")), nil
 }
 
 // load env vars cfg
 func init() {
 	viper.AutomaticEnv()
+	viper.SetDefault("CEP_PROVIDERS", provider.ViaCepName)
+	viper.SetDefault("CEPURL", provider.DefaultViaCepURL)
+	viper.SetDefault("BRASILAPI_CEPURL", provider.DefaultBrasilAPIURL)
+	viper.SetDefault("AWESOMEAPI_CEPURL", provider.DefaultAwesomeAPIURL)
+	viper.SetDefault("WEATHER_PROVIDERS", provider.WeatherAPIName)
+	viper.SetDefault("PROVIDER_TIMEOUT", 5*time.Second)
+	viper.SetDefault("CACHE_BACKEND", "memory")
+	viper.SetDefault("CEP_CACHE_SIZE", 10000)
+	viper.SetDefault("CEP_CACHE_TTL", 24*time.Hour)
+	viper.SetDefault("CEP_CACHE_NEGATIVE_TTL", 10*time.Minute)
+	viper.SetDefault("WEATHER_CACHE_SIZE", 1000)
+	viper.SetDefault("WEATHER_CACHE_TTL", 5*time.Minute)
+	viper.SetDefault("WEATHER_CACHE_STALE_TTL", time.Hour)
+	viper.SetDefault("BREAKER_FAILURE_THRESHOLD", breaker.DefaultFailureThreshold)
+	viper.SetDefault("BREAKER_OPEN_TIMEOUT", breaker.DefaultOpenTimeout)
+	viper.SetDefault("RATE_LIMIT_BURST", 10)
+	viper.SetDefault("RATE_LIMIT_MAX_WAIT", 500*time.Millisecond)
+	viper.SetDefault("RETRY_MAX_ATTEMPTS", retry.DefaultMaxAttempts)
+	viper.SetDefault("RETRY_BASE_DELAY", retry.DefaultBaseDelay)
+	viper.SetDefault("RETRY_MAX_DELAY", retry.DefaultMaxDelay)
+	viper.SetDefault("WEATHERAPI_KEY_COOLDOWN", secret.DefaultCooldown)
+	viper.SetDefault("OTEL_METRIC_EXPORT_INTERVAL", 15*time.Second)
+	viper.SetDefault("METRICS_ENABLED", true)
+	viper.SetDefault("BAGGAGE_SPAN_ATTRIBUTES", strings.Join([]string{tracing.ClientIDKey, tracing.TenantKey, tracing.ChannelKey}, ","))
+	viper.SetDefault("LOG_FORMAT", logging.FormatJSON)
+	viper.SetDefault("LOG_LEVEL", "info")
+}
+
+// newLogger builds the logger set up in LOG_FORMAT and LOG_LEVEL, handing the
+// records to bridge too when set
+func newLogger(bridge slog.Handler) (*slog.Logger, error) {
+	level, err := logging.ParseLevel(viper.GetString("LOG_LEVEL"))
+	if err != nil {
+		return nil, err
+	}
+	return logging.New(secret.NewWriter(os.Stderr), logging.Options{
+		Format: viper.GetString("LOG_FORMAT"),
+		Level:  level,
+		Bridge: bridge,
+		Redact: redactor(),
+	})
+}
+
+// redactor returns what hides the api keys and, with a CEP_HASH_KEY, hashes the
+// CEPs in what is logged or exported, see tracing.NewCepHasher. Bare CEPs are
+// told apart by what they follow: the cep cache key prefix or the url of a CEP
+// provider.
+func redactor() func(string) string {
+	prefixes := []string{provider.CepKeyPrefix}
+	for _, template := range cepURLs() {
+		if prefix, _, found := strings.Cut(template, "%s"); found {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	hashCeps := tracing.NewCepHasher([]byte(viper.GetString("CEP_HASH_KEY")), prefixes...)
+	return func(s string) string {
+		return hashCeps(secret.Redact(s))
+	}
+}
+
+// cepURLs are the url templates of the CEP providers, by provider name
+func cepURLs() map[string]string {
+	return map[string]string{
+		provider.ViaCepName:     viper.GetString("CEPURL"),
+		provider.BrasilAPIName:  viper.GetString("BRASILAPI_CEPURL"),
+		provider.AwesomeAPIName: viper.GetString("AWESOMEAPI_CEPURL"),
+	}
+}
+
+// fatal logs err as the reason the service stops, and stops it
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// serveMetrics returns the handler of /metrics for the main router, nil when
+// the metrics are off or METRICS_PORT gives them a port of their own, the
+// admin one, kept apart from the public API
+func serveMetrics(handler http.Handler) http.Handler {
+	port := viper.GetString("METRICS_PORT")
+	if handler == nil || port == "" {
+		return handler
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	go func() {
+		slog.Info("starting metrics server", "port", port)
+		if err := http.ListenAndServe(port, mux); err != nil {
+			fatal("metrics server stopped", err)
+		}
+	}()
+	return nil
 }
 
 func main() {
+	logger, err := newLogger(nil)
+	if err != nil {
+		fatal("failed to set up logging", err)
+	}
+	slog.SetDefault(logger)
+
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	shutdown, err := initProvider(viper.GetString("OTEL_SERVICE_NAME"), viper.GetString("OTEL_EXPORTER_OTLP_ENDPOINT"))
+	var readers []sdkmetric.Reader
+	var metricsHandler http.Handler
+	if viper.GetBool("METRICS_ENABLED") {
+		reader, handler, err := metrics.NewPrometheus()
+		if err != nil {
+			fatal("failed to start", err)
+		}
+		readers, metricsHandler = append(readers, reader), handler
+	}
+
+	shutdown, err := initProvider(viper.GetString("OTEL_SERVICE_NAME"), viper.GetString("OTEL_EXPORTER_OTLP_ENDPOINT"), readers...)
+	if err != nil {
+		fatal("failed to set up telemetry", err)
+	}
+	// a partir daqui os logs seguem também para o coletor, com o trace de cada
+	// requisição
+	logger, err = newLogger(otelslog.NewHandler("microservice-logger"))
 	if err != nil {
-		log.Fatal(err)
+		fatal("failed to set up logging", err)
 	}
+	slog.SetDefault(logger)
 	defer func() {
 		if err := shutdown(ctx); err != nil {
-			log.Fatal("failed to shutdown TracerProvider: %w", err)
+			slog.Error("failed to shutdown the telemetry providers", "error", err)
 		}
 	}()
 
 	tracer := otel.Tracer("microservice-tracer")
+	meter := otel.Meter("microservice-meter")
+	measurements, err := metrics.New(meter)
+	if err != nil {
+		fatal("failed to start", err)
+	}
+
+	// chamadas aos provedores são repetidas em falhas transitórias, cada
+	// tentativa com o seu span de cliente e a sua ficha do limite do provedor.
+	// O baggage, com a identidade dos clientes do serviço A, não sai para os
+	// provedores.
+	client := &http.Client{
+		Transport: retry.NewTransport(httpclient.NewTransport(http.DefaultTransport, otelhttp.WithPropagators(propagation.TraceContext{})), retry.Policy{
+			MaxAttempts: viper.GetInt("RETRY_MAX_ATTEMPTS"),
+			BaseDelay:   viper.GetDuration("RETRY_BASE_DELAY"),
+			MaxDelay:    viper.GetDuration("RETRY_MAX_DELAY"),
+		}),
+	}
+
+	cepProviders, err := provider.NewCepProviders(
+		strings.Split(viper.GetString("CEP_PROVIDERS"), ","),
+		cepURLs(),
+		client,
+	)
+	if err != nil {
+		fatal("failed to start", err)
+	}
+
+	weatherURL, weatherAPIKeys, err := weatherAPIKeys()
+	if err != nil {
+		fatal("failed to start", err)
+	}
+	weatherNames := strings.Split(viper.GetString("WEATHER_PROVIDERS"), ",")
+	if weatherAPIKeys.Len() == 0 && len(weatherNames) > 1 {
+		// sem chave o weatherapi fica de fora, desde que sobre outro provedor
+		slog.Warn("weatherapi has no api key in WEATHERAPI_KEY or WEATHERAPI_KEY_FILE, leaving it out")
+		var names []string
+		for _, name := range weatherNames {
+			if !strings.EqualFold(strings.TrimSpace(name), provider.WeatherAPIName) {
+				names = append(names, name)
+			}
+		}
+		weatherNames = names
+	}
+	weatherProviders, err := provider.NewWeatherProviders(
+		weatherNames,
+		map[string]string{
+			provider.WeatherAPIName:        weatherURL,
+			provider.OpenMeteoName:         viper.GetString("OPENMETEO_URL"),
+			provider.OpenMeteoGeocodingKey: viper.GetString("OPENMETEO_GEOCODING_URL"),
+			provider.OpenMeteoArchiveKey:   viper.GetString("OPENMETEO_ARCHIVE_URL"),
+		},
+		weatherAPIKeys,
+		client,
+	)
+	if err != nil {
+		fatal("failed to start", err)
+	}
+
+	for i, p := range cepProviders {
+		b, err := newBreaker(p.Name(), meter)
+		if err != nil {
+			fatal("failed to start", err)
+		}
+		cepProviders[i] = provider.NewBreakerCep(p, b)
+		if l := newLimiter(p.Name()); l != nil {
+			cepProviders[i] = provider.NewLimitedCep(cepProviders[i], l)
+		}
+	}
+	for i, p := range weatherProviders {
+		b, err := newBreaker(p.Name(), meter)
+		if err != nil {
+			fatal("failed to start", err)
+		}
+		weatherProviders[i] = provider.NewBreakerWeather(p, b)
+		if l := newLimiter(p.Name()); l != nil {
+			weatherProviders[i] = provider.NewLimitedWeather(weatherProviders[i], l)
+		}
+	}
+
+	cepCache, weatherCache, err := newCaches(tracer)
+	if err != nil {
+		fatal("failed to start", err)
+	}
+
+	geocoder := provider.NewOpenMeteoGeocoder(viper.GetString("OPENMETEO_GEOCODING_URL"), client)
+	cepChain := provider.NewCepChain(tracer, viper.GetDuration("PROVIDER_TIMEOUT"), cepProviders...)
+	cepChain.Metrics = measurements
+	weatherChain := provider.NewWeatherChain(tracer, viper.GetDuration("PROVIDER_TIMEOUT"), weatherProviders...)
+	weatherChain.Metrics = measurements
+	cepProvider := provider.NewCachedCep(
+		provider.NewGeocodedCep(cepChain, geocoder, tracer),
+		cepCache,
+		viper.GetDuration("CEP_CACHE_TTL"),
+		viper.GetDuration("CEP_CACHE_NEGATIVE_TTL"),
+	)
+	weatherProvider := provider.NewCachedWeather(
+		weatherChain,
+		weatherCache,
+		viper.GetDuration("WEATHER_CACHE_TTL"),
+		viper.GetDuration("WEATHER_CACHE_STALE_TTL"),
+	)
 
+	cepHashKey := viper.GetString("CEP_HASH_KEY")
+	secret.Register(cepHashKey)
 	serviceData := &web.ServiceData{
 		Title:              viper.GetString("TITLE"),
-		CepURL:             viper.GetString("CEPURL"),
-		WeatherURL:         viper.GetString("WEATHERURL"),
+		CepProvider:        cepProvider,
+		WeatherProvider:    weatherProvider,
 		ExternalCallMethod: viper.GetString("EXTERNAL_CALL_METHOD"),
 		RequestNameOTEL:    viper.GetString("REQUEST_NAME_OTEL"),
 		OTELTracer:         tracer,
+		CepHashKey:         []byte(cepHashKey),
+		Metrics:            measurements,
+		MetricsHandler:     serveMetrics(metricsHandler),
 	}
 	server := web.NewServer(serviceData)
 	router := server.CreateServer()
 
 	go func() {
-		log.Println("Starting server on port", viper.GetString("HTTP_PORT"))
+		slog.Info("starting server", "port", viper.GetString("HTTP_PORT"))
 		if err := http.ListenAndServe(viper.GetString("HTTP_PORT"), router); err != nil {
-			log.Fatal(err)
+			fatal("server stopped", err)
 		}
 	}()
 
 	select {
 	case <-sigCh:
-		log.Println("Shutting down gracefully, CTRL+C pressed...")
+		slog.Info("shutting down gracefully, CTRL+C pressed")
 	case <-ctx.Done():
-		log.Println("Shutting down due to other reason...")
+		slog.Info("shutting down due to other reason")
 	}
 
 	// Create a timeout context for the graceful shutdown
@@ -0,0 +1,151 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var errUpstream = errors.New("upstream failed")
+
+func newTestBreaker(t *testing.T, reader sdkmetric.Reader) (*Breaker, *time.Time) {
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	b, err := New("viacep", Settings{FailureThreshold: 2, OpenTimeout: time.Minute}, meter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func fail(context.Context) error    { return errUpstream }
+func succeed(context.Context) error { return nil }
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b, now := newTestBreaker(t, sdkmetric.NewManualReader())
+	ctx := context.Background()
+
+	assert.ErrorIs(t, b.Do(ctx, fail), errUpstream)
+	assert.Equal(t, Closed, b.State())
+	assert.ErrorIs(t, b.Do(ctx, fail), errUpstream)
+	assert.Equal(t, Open, b.State())
+
+	called := false
+	err := b.Do(ctx, func(context.Context) error { called = true; return nil })
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.False(t, called)
+
+	// o probe só passa depois do OpenTimeout
+	*now = now.Add(time.Minute)
+	assert.NoError(t, b.Do(ctx, succeed))
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	b, _ := newTestBreaker(t, sdkmetric.NewManualReader())
+	ctx := context.Background()
+
+	b.Do(ctx, fail)
+	b.Do(ctx, succeed)
+	b.Do(ctx, fail)
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestBreakerIgnoresNonFailures(t *testing.T) {
+	b, _ := newTestBreaker(t, sdkmetric.NewManualReader())
+	notFound := errors.New("not found")
+	b.IsFailure = func(err error) bool { return !errors.Is(err, notFound) }
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		b.Do(ctx, func(context.Context) error { return notFound })
+	}
+	b.Do(ctx, func(context.Context) error { return context.Canceled })
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestBreakerHalfOpenAllowsSingleProbe(t *testing.T) {
+	b, now := newTestBreaker(t, sdkmetric.NewManualReader())
+	ctx := context.Background()
+
+	b.Do(ctx, fail)
+	b.Do(ctx, fail)
+	*now = now.Add(time.Minute)
+
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- b.Do(ctx, func(context.Context) error {
+			close(probing)
+			<-release
+			return errUpstream
+		})
+	}()
+	<-probing
+	assert.Equal(t, HalfOpen, b.State())
+	assert.ErrorIs(t, b.Do(ctx, succeed), ErrOpen)
+
+	close(release)
+	assert.ErrorIs(t, <-done, errUpstream)
+	// o probe falhou, então o breaker volta a ficar aberto por mais um OpenTimeout
+	assert.Equal(t, Open, b.State())
+	assert.ErrorIs(t, b.Do(ctx, succeed), ErrOpen)
+}
+
+func TestBreakerCanceledProbe(t *testing.T) {
+	b, now := newTestBreaker(t, sdkmetric.NewManualReader())
+	ctx := context.Background()
+
+	b.Do(ctx, fail)
+	b.Do(ctx, fail)
+	*now = now.Add(time.Minute)
+
+	// o probe cancelado não mostra que o upstream voltou: o breaker segue
+	// half-open e a próxima chamada é o novo probe
+	assert.ErrorIs(t, b.Do(ctx, func(context.Context) error { return context.Canceled }), context.Canceled)
+	assert.Equal(t, HalfOpen, b.State())
+	assert.ErrorIs(t, b.Do(ctx, fail), errUpstream)
+	assert.Equal(t, Open, b.State())
+}
+
+func TestBreakerRecordsTransitions(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	b, _ := newTestBreaker(t, reader)
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	ctx, span := tracer.Start(context.Background(), "request")
+	b.Do(ctx, fail)
+	b.Do(ctx, fail)
+	span.End()
+
+	events := recorder.Ended()[0].Events()
+	assert.Len(t, events, 1)
+	assert.Equal(t, "circuit breaker state change", events[0].Name)
+	assert.Contains(t, events[0].Attributes, attribute.String("breaker.to", "open"))
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	metrics := map[string]metricdata.Aggregation{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m.Data
+	}
+
+	transitions := metrics["circuit_breaker.transitions"].(metricdata.Sum[int64])
+	assert.Len(t, transitions.DataPoints, 1)
+	assert.Equal(t, int64(1), transitions.DataPoints[0].Value)
+	state := metrics["circuit_breaker.state"].(metricdata.Gauge[int64])
+	assert.Equal(t, int64(Open), state.DataPoints[0].Value)
+}
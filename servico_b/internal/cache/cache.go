@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache stores opaque values for a ttl. Backends other than Memory can be
+// shared by every replica of the service.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Memory is a Cache kept in a local LRU
+type Memory struct {
+	lru *LRU
+}
+
+// NewMemory creates a Memory cache holding at most capacity entries
+func NewMemory(capacity int) *Memory {
+	return &Memory{lru: NewLRU(capacity)}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	v, ok := m.lru.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	return v.([]byte), true, nil
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.lru.Set(key, value, ttl)
+	return nil
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestBackends(t *testing.T) {
+	mr := miniredis.RunT(t)
+	backends := map[string]Cache{
+		"memory": NewMemory(10),
+		"redis":  NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+	}
+
+	for name, c := range backends {
+		ctx := context.Background()
+
+		_, ok, err := c.Get(ctx, "cep:01001000")
+		assert.NoError(t, err, name)
+		assert.False(t, ok, name)
+
+		assert.NoError(t, c.Set(ctx, "cep:01001000", []byte(`{"localidade": "São Paulo"}`), time.Minute), name)
+		value, ok, err := c.Get(ctx, "cep:01001000")
+		assert.NoError(t, err, name)
+		assert.True(t, ok, name)
+		assert.Equal(t, `{"localidade": "São Paulo"}`, string(value), name)
+
+		assert.NoError(t, c.Set(ctx, "cep:00000000", []byte(`{}`), 0), name)
+		_, ok, _ = c.Get(ctx, "cep:00000000")
+		assert.False(t, ok, name)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	_, ok, _ := backends["redis"].Get(context.Background(), "cep:01001000")
+	assert.False(t, ok)
+}
+
+func TestRedisSharedBetweenReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+	replicaA := NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	replicaB := NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	assert.NoError(t, replicaA.Set(context.Background(), "weather:guarulhos/SP", []byte("25"), time.Minute))
+	value, ok, err := replicaB.Get(context.Background(), "weather:guarulhos/SP")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "25", string(value))
+}
+
+func TestTracedCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	c := NewTraced(NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()})), "redis", tracer)
+
+	c.Get(context.Background(), "cep:01001000")
+	c.Set(context.Background(), "cep:01001000", []byte("{}"), time.Minute)
+	c.Get(context.Background(), "cep:01001000")
+
+	mr.Close()
+	_, _, err := c.Get(context.Background(), "cep:01001000")
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 4)
+	var names []string
+	var hits []bool
+	for _, span := range spans {
+		names = append(names, span.Name())
+		for _, kv := range span.Attributes() {
+			if kv.Key == "cache.hit" {
+				hits = append(hits, kv.Value.AsBool())
+			}
+		}
+	}
+	assert.Equal(t, []string{"cache get", "cache set", "cache get", "cache get"}, names)
+	assert.Equal(t, []bool{false, true, false}, hits)
+	assert.Equal(t, "Error", spans[3].Status().Code.String())
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU(2)
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 2, time.Minute)
+
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+
+	c.Set("c", 3, time.Minute)
+	assert.Equal(t, 2, c.Len())
+
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	v, ok = c.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 3, v)
+}
+
+func TestLRUExpiresEntries(t *testing.T) {
+	now := time.Now()
+	c := NewLRU(10)
+	c.now = func() time.Time { return now }
+
+	c.Set("short", "x", time.Second)
+	c.Set("long", "y", time.Hour)
+
+	now = now.Add(time.Minute)
+	_, ok := c.Get("short")
+	assert.False(t, ok)
+	_, ok = c.Get("long")
+	assert.True(t, ok)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestLRUDisabled(t *testing.T) {
+	c := NewLRU(0)
+	c.Set("a", 1, time.Minute)
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+}
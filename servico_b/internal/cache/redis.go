@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a Cache kept in any server speaking the Redis protocol
+type Redis struct {
+	Client redis.UniversalClient
+}
+
+// NewRedis creates a Redis cache on top of client
+func NewRedis(client redis.UniversalClient) *Redis {
+	return &Redis{Client: client}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := r.Client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	return r.Client.Set(ctx, key, value, ttl).Err()
+}
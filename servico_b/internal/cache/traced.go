@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"servico_b/internal/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Traced wraps a Cache so every get and set gets its own span
+type Traced struct {
+	Cache   Cache
+	Backend string
+	Tracer  trace.Tracer
+}
+
+// NewTraced wraps c, backend names it on the spans
+func NewTraced(c Cache, backend string, tracer trace.Tracer) *Traced {
+	return &Traced{Cache: c, Backend: backend, Tracer: tracer}
+}
+
+func (t *Traced) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	ctx, span := t.Tracer.Start(ctx, "cache get", trace.WithAttributes(
+		attribute.String("cache.backend", t.Backend),
+		attribute.String("cache.key", key),
+	))
+	defer span.End()
+
+	value, ok, err := t.Cache.Get(ctx, key)
+	span.SetAttributes(attribute.Bool("cache.hit", ok))
+	tracing.RecordError(span, err)
+	return value, ok, err
+}
+
+func (t *Traced) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ctx, span := t.Tracer.Start(ctx, "cache set", trace.WithAttributes(
+		attribute.String("cache.backend", t.Backend),
+		attribute.String("cache.key", key),
+		attribute.Int64("cache.ttl_ms", ttl.Milliseconds()),
+	))
+	defer span.End()
+
+	err := t.Cache.Set(ctx, key, value, ttl)
+	tracing.RecordError(span, err)
+	return err
+}
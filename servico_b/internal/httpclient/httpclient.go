@@ -0,0 +1,163 @@
+// Package httpclient builds the instrumented transport of the calls to the
+// providers, which the retries are layered over and the rate limits gate.
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redacted replaces credentials and sensitive query values in url.full
+const Redacted = "REDACTED"
+
+// sensitiveParams are the query parameters whose values never reach a span
+var sensitiveParams = map[string]bool{
+	"key": true, "apikey": true, "api_key": true, "token": true, "access_token": true,
+	"sig": true, "signature": true, "password": true, "secret": true,
+}
+
+// Default is the client of calls made without one
+var Default = New()
+
+// New returns a client sending its requests through NewTransport
+func New(opts ...otelhttp.Option) *http.Client {
+	return &http.Client{Transport: NewTransport(nil, opts...)}
+}
+
+// NewTransport wraps base, http.DefaultTransport when nil, with otelhttp:
+// every request gets a client span and carries its trace context in the
+// headers. Besides the otelhttp attributes, the span gets the stable semantic
+// convention ones, with url.full redacted. Requests first wait on the gate of
+// their context, see WithGate.
+func NewTransport(base http.RoundTripper, opts ...otelhttp.Option) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &gateTransport{base: otelhttp.NewTransport(&semconvTransport{base: base}, opts...)}
+}
+
+// GateError is returned for a request its gate held back, which was not sent
+type GateError struct {
+	Err error
+}
+
+func (e *GateError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *GateError) Unwrap() error {
+	return e.Err
+}
+
+// gateTransport runs the gate of the request before it is sent, so a request
+// held back gets no client span
+type gateTransport struct {
+	base http.RoundTripper
+}
+
+func (t *gateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if gate, ok := req.Context().Value(gateKey{}).(func(context.Context) error); ok {
+		if err := gate(req.Context()); err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, &GateError{Err: err}
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// semconvTransport runs under the otelhttp span, which it finds in the request
+// context
+type semconvTransport struct {
+	base http.RoundTripper
+}
+
+func (t *semconvTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	span := trace.SpanFromContext(req.Context())
+	span.SetAttributes(
+		attribute.String("http.request.method", req.Method),
+		attribute.String("url.full", RedactURL(req.URL)),
+		attribute.String("server.address", req.URL.Hostname()),
+		attribute.Int("server.port", port(req.URL)),
+	)
+	if n := ResendCount(req.Context()); n > 0 {
+		span.SetAttributes(attribute.Int("http.request.resend_count", n))
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.SetAttributes(attribute.String("error.type", fmt.Sprintf("%T", err)))
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetAttributes(attribute.String("error.type", strconv.Itoa(resp.StatusCode)))
+	}
+	return resp, nil
+}
+
+// RedactURL writes u without its credentials and with the values of sensitive
+// query parameters, such as api keys, replaced by Redacted
+func RedactURL(u *url.URL) string {
+	redacted := *u
+	if redacted.User != nil {
+		redacted.User = url.UserPassword(Redacted, Redacted)
+	}
+	if redacted.RawQuery != "" {
+		params := strings.Split(redacted.RawQuery, "&")
+		for i, param := range params {
+			rawName, _, found := strings.Cut(param, "=")
+			name, err := url.QueryUnescape(rawName)
+			if err != nil {
+				name = rawName
+			}
+			if found && sensitiveParams[strings.ToLower(name)] {
+				params[i] = rawName + "=" + Redacted
+			}
+		}
+		redacted.RawQuery = strings.Join(params, "&")
+	}
+	return redacted.String()
+}
+
+func port(u *url.URL) int {
+	if p, err := strconv.Atoi(u.Port()); err == nil {
+		return p
+	}
+	if u.Scheme == "https" {
+		return 443
+	}
+	return 80
+}
+
+type gateKey struct{}
+
+// WithGate makes every request sent with ctx wait on gate before it goes out,
+// each retry included, as a rate limit needs. An error from gate is returned,
+// as a GateError, instead of sending the request.
+func WithGate(ctx context.Context, gate func(context.Context) error) context.Context {
+	return context.WithValue(ctx, gateKey{}, gate)
+}
+
+type resendCountKey struct{}
+
+// WithResendCount marks the requests sent with ctx as resent n times, for the
+// http.request.resend_count attribute
+func WithResendCount(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, resendCountKey{}, n)
+}
+
+// ResendCount returns how many times the request of ctx was resent
+func ResendCount(ctx context.Context) int {
+	n, _ := ctx.Value(resendCountKey{}).(int)
+	return n
+}
@@ -0,0 +1,55 @@
+package i18n
+
+// portuguese translates the messages of servico B, keyed by their English text
+var portuguese = map[string]string{
+	// problem details
+	"invalid zipcode":               "cep inválido",
+	"can not find zip code":         "não foi possível encontrar o cep",
+	"internal error":                "erro interno",
+	"days must be between 1 and %d": "days deve estar entre 1 e %d",
+	"could not find the current weather for the zip code locality": "não foi possível encontrar o tempo atual da localidade do cep",
+	"could not find the forecast for the zip code locality":        "não foi possível encontrar a previsão do tempo da localidade do cep",
+	"could not find the weather history for the zip code locality": "não foi possível encontrar o histórico do tempo da localidade do cep",
+	"upstream providers unavailable, try again later":              "provedores indisponíveis, tente novamente mais tarde",
+	"upstream rate limit reached, try again later":                 "limite de chamadas aos provedores atingido, tente novamente mais tarde",
+	"invalid start date":                        "data inicial inválida",
+	"invalid end date":                          "data final inválida",
+	"end date before start date":                "data final anterior à data inicial",
+	"dates must not be in the future":           "as datas não podem estar no futuro",
+	"date range too long":                       "intervalo de datas longo demais",
+	"invalid detail %q, expected basic or full": "detail %q inválido, esperado basic ou full",
+	"unknown field %q, expected some of %s":     "campo %q desconhecido, esperado algum de %s",
+	"route not found":                           "rota não encontrada",
+	"method %s not allowed":                     "método %s não permitido",
+	"request timed out":                         "tempo da requisição esgotado",
+
+	// Open-Meteo weather conditions (WMO codes)
+	"Clear sky":                     "Céu limpo",
+	"Mainly clear":                  "Predominantemente limpo",
+	"Partly cloudy":                 "Parcialmente nublado",
+	"Overcast":                      "Encoberto",
+	"Fog":                           "Nevoeiro",
+	"Depositing rime fog":           "Nevoeiro com geada",
+	"Light drizzle":                 "Garoa fraca",
+	"Moderate drizzle":              "Garoa moderada",
+	"Dense drizzle":                 "Garoa intensa",
+	"Light freezing drizzle":        "Garoa congelante fraca",
+	"Dense freezing drizzle":        "Garoa congelante intensa",
+	"Slight rain":                   "Chuva fraca",
+	"Moderate rain":                 "Chuva moderada",
+	"Heavy rain":                    "Chuva forte",
+	"Light freezing rain":           "Chuva congelante fraca",
+	"Heavy freezing rain":           "Chuva congelante forte",
+	"Slight snow fall":              "Neve fraca",
+	"Moderate snow fall":            "Neve moderada",
+	"Heavy snow fall":               "Neve forte",
+	"Snow grains":                   "Grãos de neve",
+	"Slight rain showers":           "Pancadas de chuva fracas",
+	"Moderate rain showers":         "Pancadas de chuva moderadas",
+	"Violent rain showers":          "Pancadas de chuva violentas",
+	"Slight snow showers":           "Pancadas de neve fracas",
+	"Heavy snow showers":            "Pancadas de neve fortes",
+	"Thunderstorm":                  "Trovoada",
+	"Thunderstorm with slight hail": "Trovoada com granizo fraco",
+	"Thunderstorm with heavy hail":  "Trovoada com granizo forte",
+}
@@ -0,0 +1,63 @@
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func TestNegotiate(t *testing.T) {
+	for header, expected := range map[string]language.Tag{
+		"":                        language.English,
+		"pt-BR,pt;q=0.9,en;q=0.8": language.BrazilianPortuguese,
+		"pt":                      language.BrazilianPortuguese,
+		"en-US,pt;q=0.5":          language.English,
+		"fr-FR":                   language.English,
+		"*":                       language.English,
+		"not a language;;":        language.English,
+	} {
+		assert.Equal(t, expected, Negotiate(header), header)
+	}
+}
+
+func TestSprintf(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "days must be between 1 and 14", Sprintf(ctx, "days must be between 1 and %d", 14))
+	assert.Equal(t, "Clear sky", Sprintf(ctx, "Clear sky"))
+
+	ctx = WithLanguage(ctx, language.BrazilianPortuguese)
+	assert.Equal(t, "days deve estar entre 1 e 14", Sprintf(ctx, "days must be between 1 and %d", 14))
+	assert.Equal(t, "Céu limpo", Sprintf(ctx, "Clear sky"))
+	// mensagens fora do catálogo saem como estão
+	assert.Equal(t, "sem tradução", Sprintf(ctx, "sem tradução"))
+}
+
+func TestMessage(t *testing.T) {
+	ctx := WithLanguage(context.Background(), language.BrazilianPortuguese)
+
+	err := fmt.Errorf("fields: %w", Errorf("invalid detail %q, expected basic or full", "all"))
+	assert.Equal(t, `fields: invalid detail "all", expected basic or full`, err.Error())
+	assert.Equal(t, `detail "all" inválido, esperado basic ou full`, Message(ctx, err))
+	assert.Equal(t, "boom", Message(ctx, fmt.Errorf("boom")))
+}
+
+func TestMiddleware(t *testing.T) {
+	var lang language.Tag
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang = FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "pt-BR")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, language.BrazilianPortuguese, lang)
+	assert.Equal(t, "pt-BR", w.Header().Get("Content-Language"))
+	assert.Equal(t, "Accept-Language", w.Header().Get("Vary"))
+}
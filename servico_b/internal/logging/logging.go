@@ -0,0 +1,188 @@
+// Package logging builds the slog logger of servico B. Records carry the trace
+// and span of their context and go both to the output and to the collector
+// through the OTel bridge, with the api keys of the providers redacted from
+// both.
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"servico_b/internal/tracing"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Keys of the trace and span ids added to the records with a span in context
+const (
+	TraceIDKey = "trace_id"
+	SpanIDKey  = "span_id"
+)
+
+// Output formats, for Options.Format
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Options configure the logger built by New
+type Options struct {
+	// Format is FormatJSON, the default, or FormatText
+	Format string
+	// Level is the lowest level logged, slog.LevelInfo when nil
+	Level slog.Leveler
+	// Bridge, when set, gets the records too, as the otelslog handler does to
+	// send them to the collector. It reads the trace from the context itself.
+	Bridge slog.Handler
+	// Redact, when set, rewrites the message and the string and error values
+	// of the records before they leave, to keep secrets out of the logs
+	Redact func(string) string
+}
+
+// New builds the logger writing to w with options
+func New(w io.Writer, options Options) (*slog.Logger, error) {
+	level := options.Level
+	if level == nil {
+		level = slog.LevelInfo
+	}
+	handlerOptions := &slog.HandlerOptions{Level: level}
+
+	var out slog.Handler
+	switch options.Format {
+	case FormatJSON, "":
+		out = slog.NewJSONHandler(w, handlerOptions)
+	case FormatText:
+		out = slog.NewTextHandler(w, handlerOptions)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", options.Format)
+	}
+	return slog.New(&handler{level: level, out: out, bridge: options.Bridge, redact: options.Redact}), nil
+}
+
+// ParseLevel parses the name of a level, such as debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// handler hands the records to out, with the trace and span of their context,
+// and to bridge
+type handler struct {
+	level  slog.Leveler
+	out    slog.Handler
+	bridge slog.Handler
+	redact func(string) string
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	r = h.redactRecord(r)
+	var errs []error
+	if h.bridge != nil {
+		errs = append(errs, h.bridge.Handle(ctx, r.Clone()))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String(TraceIDKey, sc.TraceID().String()), slog.String(SpanIDKey, sc.SpanID().String()))
+	}
+	errs = append(errs, h.out.Handle(ctx, r))
+	return errors.Join(errs...)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if h.redact != nil {
+		redacted := make([]slog.Attr, len(attrs))
+		for i, a := range attrs {
+			redacted[i] = h.redactAttr(a)
+		}
+		attrs = redacted
+	}
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+// with returns a copy of h whose handlers are derived by derive
+func (h *handler) with(derive func(slog.Handler) slog.Handler) *handler {
+	h2 := *h
+	h2.out = derive(h.out)
+	if h.bridge != nil {
+		h2.bridge = derive(h.bridge)
+	}
+	return &h2
+}
+
+func (h *handler) redactRecord(r slog.Record) slog.Record {
+	if h.redact == nil {
+		return r
+	}
+	redacted := slog.NewRecord(r.Time, r.Level, h.redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(h.redactAttr(a))
+		return true
+	})
+	return redacted
+}
+
+func (h *handler) redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(h.redact(a.Value.String()))
+	case slog.KindGroup:
+		group := a.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			redacted[i] = h.redactAttr(ga)
+		}
+		a.Value = slog.GroupValue(redacted...)
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(h.redact(err.Error()))
+		}
+	}
+	return a
+}
+
+// Middleware logs every request once answered, with the trace of the span
+// its handler started, in place of chi's middleware.Logger. Server errors are
+// logged at the error level.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx, span := tracing.WithSpanSlot(r.Context())
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		if s := span(); s != nil {
+			ctx = trace.ContextWithSpan(ctx, s)
+		}
+		slog.LogAttrs(ctx, level, "request served",
+			slog.String("http.request.method", r.Method),
+			slog.String("url.path", r.URL.Path),
+			slog.Int("http.response.status_code", status),
+			slog.Int("http.response.body.size", ww.BytesWritten()),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("client.address", r.RemoteAddr),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+	})
+}
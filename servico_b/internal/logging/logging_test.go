@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"servico_b/internal/tracing"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// lines decodes the JSON records written to buf
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestNew(t *testing.T) {
+	var out, bridged bytes.Buffer
+	logger, err := New(&out, Options{
+		Level:  slog.LevelInfo,
+		Bridge: slog.NewJSONHandler(&bridged, nil),
+		Redact: func(s string) string { return strings.ReplaceAll(s, "s3cr3t", "REDACTED") },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	ctx, span := tracer.Start(context.Background(), "request")
+	defer span.End()
+
+	logger.DebugContext(ctx, "ignored")
+	logger.With("key", "s3cr3t").InfoContext(ctx, "weather asked", "err", errors.New("bad key s3cr3t"))
+	logger.Info("no trace")
+
+	records := lines(t, &out)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "weather asked", records[0]["msg"])
+	assert.Equal(t, span.SpanContext().TraceID().String(), records[0][TraceIDKey])
+	assert.Equal(t, span.SpanContext().SpanID().String(), records[0][SpanIDKey])
+	assert.Equal(t, "REDACTED", records[0]["key"])
+	assert.Equal(t, "bad key REDACTED", records[0]["err"])
+	assert.NotContains(t, records[1], TraceIDKey)
+
+	// a ponte lê o trace do contexto por conta própria
+	bridgedRecords := lines(t, &bridged)
+	assert.Len(t, bridgedRecords, 2)
+	assert.NotContains(t, bridgedRecords[0], TraceIDKey)
+	assert.Equal(t, "REDACTED", bridgedRecords[0]["key"])
+
+	_, err = New(&out, Options{Format: "xml"})
+	assert.Error(t, err)
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("debug")
+	assert.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, level)
+	level, err = ParseLevel("WARN")
+	assert.NoError(t, err)
+	assert.Equal(t, slog.LevelWarn, level)
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logger)
+
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	var traceID string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracing.StartServer(tracer, w, r, "request")
+		defer span.End()
+		traceID = span.SpanContext().TraceID().String()
+		span.Writer.WriteHeader(http.StatusBadGateway)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/forecast", nil))
+
+	// o log da requisição leva o trace do span aberto pelo handler
+	records := lines(t, &out)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "ERROR", records[0]["level"])
+	assert.Equal(t, "/forecast", records[0]["url.path"])
+	assert.Equal(t, float64(http.StatusBadGateway), records[0]["http.response.status_code"])
+	assert.Equal(t, traceID, records[0][TraceIDKey])
+}
@@ -0,0 +1,149 @@
+// Package metrics holds the instruments of the service: the RED metrics of
+// the HTTP server, the latency of the upstream calls, the cache hit ratio and
+// the outcome of the CEP lookups. A nil *Metrics records nothing, so parts of
+// the service built without one, as in the tests, need no checks.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Outcomes of a CEP lookup, for RecordCepLookup
+const (
+	CepFound    = "found"
+	CepNotFound = "not_found"
+	CepInvalid  = "invalid"
+	CepError    = "error"
+)
+
+// durationBuckets are the bucket boundaries, in seconds, the semantic
+// conventions advise for HTTP durations
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+// Metrics records the measurements of the service on its instruments
+type Metrics struct {
+	requestDuration  metric.Float64Histogram
+	upstreamDuration metric.Float64Histogram
+	cacheRequests    metric.Int64Counter
+	cepLookups       metric.Int64Counter
+}
+
+// New creates the instruments on meter
+func New(meter metric.Meter) (*Metrics, error) {
+	m := &Metrics{}
+	var err error
+	m.requestDuration, err = meter.Float64Histogram("http.server.request.duration",
+		metric.WithDescription("Duration of the HTTP requests served"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.upstreamDuration, err = meter.Float64Histogram("upstream.request.duration",
+		metric.WithDescription("Duration of the calls to the upstream providers"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.cacheRequests, err = meter.Int64Counter("cache.requests",
+		metric.WithDescription("Cache lookups by status: hit, miss or stale"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.cepLookups, err = meter.Int64Counter("cep.lookups",
+		metric.WithDescription("CEP lookups by outcome: found, not_found, invalid or error"),
+		metric.WithUnit("{lookup}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Middleware measures the requests to next by method, route and status code.
+// The route is the chi pattern, so /forecast and / are told apart while the
+// number of series stays bounded.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		attrs := []attribute.KeyValue{
+			attribute.String("http.request.method", r.Method),
+			attribute.Int("http.response.status_code", status),
+		}
+		if route, ok := routePattern(r); ok {
+			attrs = append(attrs, attribute.String("http.route", route))
+		}
+		if status >= http.StatusInternalServerError {
+			attrs = append(attrs, attribute.String("error.type", strconv.Itoa(status)))
+		}
+		m.requestDuration.Record(r.Context(), time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+	})
+}
+
+// routePattern returns the chi pattern of the route r was served by, false
+// when no route matched
+func routePattern(r *http.Request) (string, bool) {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || len(rctx.RoutePatterns) == 0 {
+		return "", false
+	}
+	// chi trims the trailing slash of the patterns, leaving nothing of "/"
+	if route := rctx.RoutePattern(); route != "" {
+		return route, true
+	}
+	return "/", true
+}
+
+// RecordUpstream records a call to the upstream name that took d and ended
+// with outcome, such as success, not_found or timeout
+func (m *Metrics) RecordUpstream(ctx context.Context, name, outcome string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.upstreamDuration.Record(ctx, d.Seconds(), metric.WithAttributes(
+		attribute.String("upstream.name", name),
+		attribute.String("outcome", outcome),
+	))
+}
+
+// RecordCache records a lookup in the cache name answered with status
+func (m *Metrics) RecordCache(ctx context.Context, name, status string) {
+	if m == nil || status == "" {
+		return
+	}
+	m.cacheRequests.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("cache.name", name),
+		attribute.String("cache.status", status),
+	))
+}
+
+// RecordCepLookup records the outcome of a CEP lookup, one of the Cep constants
+func (m *Metrics) RecordCepLookup(ctx context.Context, outcome string) {
+	if m == nil {
+		return
+	}
+	m.cepLookups.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", outcome)))
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func newTestMetrics(t *testing.T) (*Metrics, func() map[string]metricdata.Aggregation) {
+	reader := sdkmetric.NewManualReader()
+	m, err := New(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collect := func() map[string]metricdata.Aggregation {
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(context.Background(), &rm); err != nil {
+			t.Fatal(err)
+		}
+		data := map[string]metricdata.Aggregation{}
+		for _, m := range rm.ScopeMetrics[0].Metrics {
+			data[m.Name] = m.Data
+		}
+		return data
+	}
+	return m, collect
+}
+
+func TestMiddleware(t *testing.T) {
+	m, collect := newTestMetrics(t)
+
+	router := chi.NewRouter()
+	router.Use(m.Middleware)
+	router.Post("/forecast", func(w http.ResponseWriter, r *http.Request) {})
+	router.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	for _, path := range []string{"/forecast", "/forecast", "/"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	}
+
+	points := collect()["http.server.request.duration"].(metricdata.Histogram[float64]).DataPoints
+	assert.Len(t, points, 2)
+	counts := map[attribute.Set]uint64{}
+	for _, p := range points {
+		counts[p.Attributes] = p.Count
+	}
+	assert.Equal(t, uint64(2), counts[attribute.NewSet(
+		attribute.String("http.request.method", "POST"),
+		attribute.String("http.route", "/forecast"),
+		attribute.Int("http.response.status_code", http.StatusOK),
+	)])
+	assert.Equal(t, uint64(1), counts[attribute.NewSet(
+		attribute.String("http.request.method", "POST"),
+		attribute.String("http.route", "/"),
+		attribute.Int("http.response.status_code", http.StatusBadGateway),
+		attribute.String("error.type", "502"),
+	)])
+}
+
+func TestRecord(t *testing.T) {
+	m, collect := newTestMetrics(t)
+	ctx := context.Background()
+
+	m.RecordUpstream(ctx, "viacep", "success", 20*time.Millisecond)
+	m.RecordUpstream(ctx, "viacep", "timeout", 5*time.Second)
+	m.RecordCache(ctx, "weather", "hit")
+	m.RecordCache(ctx, "weather", "hit")
+	m.RecordCache(ctx, "weather", "miss")
+	m.RecordCache(ctx, "weather", "")
+	m.RecordCepLookup(ctx, CepFound)
+	m.RecordCepLookup(ctx, CepInvalid)
+	data := collect()
+
+	upstream := data["upstream.request.duration"].(metricdata.Histogram[float64]).DataPoints
+	assert.Len(t, upstream, 2)
+	for _, p := range upstream {
+		outcome, _ := p.Attributes.Value("outcome")
+		if outcome.AsString() == "timeout" {
+			assert.Equal(t, 5.0, p.Sum)
+		}
+	}
+
+	sums := func(name string) map[string]int64 {
+		values := map[string]int64{}
+		for _, p := range data[name].(metricdata.Sum[int64]).DataPoints {
+			values[p.Attributes.Encoded(attribute.DefaultEncoder())] = p.Value
+		}
+		return values
+	}
+	// um status vazio não é uma consulta ao cache
+	assert.Equal(t, map[string]int64{
+		"cache.name=weather,cache.status=hit":  2,
+		"cache.name=weather,cache.status=miss": 1,
+	}, sums("cache.requests"))
+	assert.Equal(t, map[string]int64{"outcome=found": 1, "outcome=invalid": 1}, sums("cep.lookups"))
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	ctx := context.Background()
+
+	// sem métricas nada é gravado, e nada quebra
+	m.RecordUpstream(ctx, "viacep", "success", time.Millisecond)
+	m.RecordCache(ctx, "cep", "hit")
+	m.RecordCepLookup(ctx, CepFound)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	w := httptest.NewRecorder()
+	m.Middleware(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// NewPrometheus creates the reader that exposes the instruments of the
+// MeterProvider it is given to, and the handler serving them in the Prometheus
+// text format. The instruments are still created only through OTel, the
+// registry behind the handler adds nothing but the process metrics, which OTel
+// has no instrumentation for.
+func NewPrometheus() (sdkmetric.Reader, http.Handler, error) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{})); err != nil {
+		return nil, nil, err
+	}
+	exporter, err := otelprom.New(otelprom.WithRegisterer(registry))
+	if err != nil {
+		return nil, nil, err
+	}
+	return exporter, promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry}), nil
+}
+
+// StartRuntime records the Go runtime metrics, goroutines, memory and GC
+// among them, on provider
+func StartRuntime(provider metric.MeterProvider) error {
+	return runtime.Start(
+		runtime.WithMeterProvider(provider),
+		runtime.WithMinimumReadMemStatsInterval(15*time.Second),
+	)
+}
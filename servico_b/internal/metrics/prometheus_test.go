@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestPrometheus(t *testing.T) {
+	reader, handler, err := NewPrometheus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+	m, err := New(provider.Meter("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := StartRuntime(provider); err != nil {
+		t.Fatal(err)
+	}
+	m.RecordCepLookup(context.Background(), CepFound)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body, _ := io.ReadAll(w.Body)
+
+	// os instrumentos do OTel, os do runtime do Go e os do processo
+	assert.Contains(t, string(body), `cep_lookups_total{otel_scope_name="test",otel_scope_version="",outcome="found"} 1`)
+	assert.Contains(t, string(body), "process_runtime_go_goroutines")
+	assert.Contains(t, string(body), "process_cpu_seconds_total")
+}
@@ -0,0 +1,78 @@
+// Package problem renders errors as RFC 7807 problem details, so every error
+// answer has the same shape whatever failed.
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContentType is the media type of a problem document
+const ContentType = "application/problem+json"
+
+// Stable error codes, clients may rely on them
+const (
+	CodeInvalidZipcode      = "invalid_zipcode"
+	CodeZipcodeNotFound     = "zipcode_not_found"
+	CodeInvalidDays         = "invalid_days"
+	CodeInvalidDateRange    = "invalid_date_range"
+	CodeInvalidFields       = "invalid_fields"
+	CodeWeatherLookupFailed = "weather_lookup_failed"
+	CodeUpstreamUnavailable = "upstream_unavailable"
+	CodeRateLimited         = "rate_limited"
+	CodeInternal            = "internal_error"
+	CodeRouteNotFound       = "route_not_found"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeTimeout             = "timeout"
+)
+
+// Problem is an RFC 7807 problem document. Code and TraceID are extensions:
+// Code identifies the error and TraceID the trace of the failed request.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	TraceID  string `json:"trace_id,omitempty"`
+}
+
+// New creates a problem with status and code. Problems are told apart by Code,
+// so Type is about:blank and Title the status text.
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("%s: %s", p.Code, p.Detail)
+}
+
+// Marshal encodes p stamped with the trace ID of ctx
+func Marshal(ctx context.Context, p *Problem) []byte {
+	doc := *p
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		doc.TraceID = sc.TraceID().String()
+	}
+	body, _ := json.Marshal(doc)
+	return body
+}
+
+// Write answers the request with p, stamped with the trace ID of ctx
+func Write(ctx context.Context, w http.ResponseWriter, p *Problem) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	w.Write(Marshal(ctx, p))
+	w.Write([]byte("\n"))
+}
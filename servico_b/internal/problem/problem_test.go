@@ -0,0 +1,42 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestWrite(t *testing.T) {
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	ctx, span := tracer.Start(context.Background(), "request")
+	defer span.End()
+
+	w := httptest.NewRecorder()
+	Write(ctx, w, New(http.StatusNotFound, CodeZipcodeNotFound, "can not find zip code"))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Problem{
+		Type:    "about:blank",
+		Title:   "Not Found",
+		Status:  http.StatusNotFound,
+		Detail:  "can not find zip code",
+		Code:    CodeZipcodeNotFound,
+		TraceID: span.SpanContext().TraceID().String(),
+	}, p)
+}
+
+func TestMarshalWithoutTrace(t *testing.T) {
+	body := Marshal(context.Background(), New(http.StatusInternalServerError, CodeInternal, ""))
+	assert.JSONEq(t, `{"type": "about:blank", "title": "Internal Server Error", "status": 500, "code": "internal_error"}`, string(body))
+}
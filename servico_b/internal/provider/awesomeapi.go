@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+const DefaultAwesomeAPIURL = "https://cep.awesomeapi.com.br/json/%s"
+
+type AwesomeAPIResponse struct {
+	Cep      string `json:"cep"`
+	State    string `json:"state"`
+	City     string `json:"city"`
+	CityIbge string `json:"city_ibge"`
+	Lat      string `json:"lat"`
+	Lng      string `json:"lng"`
+}
+
+// AwesomeAPI looks CEPs up on cep.awesomeapi.com.br
+type AwesomeAPI struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewAwesomeAPI creates an AwesomeAPI provider, url is a template with a %s for the CEP
+func NewAwesomeAPI(url string, client *http.Client) *AwesomeAPI {
+	if url == "" {
+		url = DefaultAwesomeAPIURL
+	}
+	return &AwesomeAPI{URL: url, Client: client}
+}
+
+func (p *AwesomeAPI) Name() string {
+	return AwesomeAPIName
+}
+
+func (p *AwesomeAPI) LookupCep(ctx context.Context, cep string) (*Address, error) {
+	var c AwesomeAPIResponse
+	err := getJSON(ctx, p.Client, fmt.Sprintf(p.URL, cep), &c)
+	if hasStatus(err, http.StatusBadRequest, http.StatusNotFound) {
+		return nil, ErrCepNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("awesomeapi: %w", err)
+	}
+	if c.City == "" {
+		return nil, ErrCepNotFound
+	}
+
+	return &Address{
+		CEP:        cep,
+		Localidade: c.City,
+		UF:         c.State,
+		IBGE:       c.CityIbge,
+		Latitude:   parseCoordinate(c.Lat),
+		Longitude:  parseCoordinate(c.Lng),
+		Provider:   AwesomeAPIName,
+	}, nil
+}
@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+const DefaultBrasilAPIURL = "https://brasilapi.com.br/api/cep/v2/%s"
+
+type BrasilAPIResponse struct {
+	Cep      string `json:"cep"`
+	State    string `json:"state"`
+	City     string `json:"city"`
+	Location struct {
+		Coordinates struct {
+			Latitude  string `json:"latitude"`
+			Longitude string `json:"longitude"`
+		} `json:"coordinates"`
+	} `json:"location"`
+}
+
+// BrasilAPI looks CEPs up on brasilapi.com.br
+type BrasilAPI struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewBrasilAPI creates a BrasilAPI provider, url is a template with a %s for the CEP
+func NewBrasilAPI(url string, client *http.Client) *BrasilAPI {
+	if url == "" {
+		url = DefaultBrasilAPIURL
+	}
+	return &BrasilAPI{URL: url, Client: client}
+}
+
+func (p *BrasilAPI) Name() string {
+	return BrasilAPIName
+}
+
+func (p *BrasilAPI) LookupCep(ctx context.Context, cep string) (*Address, error) {
+	var c BrasilAPIResponse
+	err := getJSON(ctx, p.Client, fmt.Sprintf(p.URL, cep), &c)
+	if hasStatus(err, http.StatusBadRequest, http.StatusNotFound) {
+		return nil, ErrCepNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("brasilapi: %w", err)
+	}
+	if c.City == "" {
+		return nil, ErrCepNotFound
+	}
+
+	return &Address{
+		CEP:        cep,
+		Localidade: c.City,
+		UF:         c.State,
+		Latitude:   parseCoordinate(c.Location.Coordinates.Latitude),
+		Longitude:  parseCoordinate(c.Location.Coordinates.Longitude),
+		Provider:   BrasilAPIName,
+	}, nil
+}
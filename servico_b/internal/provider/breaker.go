@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"servico_b/internal/breaker"
+	"time"
+)
+
+// IsUpstreamFailure tells whether err means the provider itself is failing, as
+// opposed to it answering that the CEP or location does not exist, our own
+// rate limit holding the call back, or the caller giving up
+func IsUpstreamFailure(err error) bool {
+	switch {
+	case errors.Is(err, ErrCepNotFound),
+		errors.Is(err, ErrLocationNotFound),
+		errors.Is(err, ErrNoData),
+		errors.Is(err, ErrRateLimited),
+		errors.Is(err, context.Canceled):
+		return false
+	default:
+		return true
+	}
+}
+
+// BreakerCep guards a CepProvider with a circuit breaker, failing fast with
+// breaker.ErrOpen while the provider keeps failing
+type BreakerCep struct {
+	Provider CepProvider
+	Breaker  *breaker.Breaker
+}
+
+// NewBreakerCep wraps p with b, only upstream failures count against b
+func NewBreakerCep(p CepProvider, b *breaker.Breaker) *BreakerCep {
+	b.IsFailure = IsUpstreamFailure
+	return &BreakerCep{Provider: p, Breaker: b}
+}
+
+func (c *BreakerCep) Name() string {
+	return c.Provider.Name()
+}
+
+func (c *BreakerCep) LookupCep(ctx context.Context, cep string) (*Address, error) {
+	var address *Address
+	err := c.Breaker.Do(ctx, func(ctx context.Context) (err error) {
+		address, err = c.Provider.LookupCep(ctx, cep)
+		return err
+	})
+	return address, err
+}
+
+// BreakerWeather guards a WeatherProvider with a circuit breaker shared by all
+// of its calls, failing fast with breaker.ErrOpen while the provider keeps failing
+type BreakerWeather struct {
+	Provider WeatherProvider
+	Breaker  *breaker.Breaker
+}
+
+// NewBreakerWeather wraps p with b, only upstream failures count against b
+func NewBreakerWeather(p WeatherProvider, b *breaker.Breaker) *BreakerWeather {
+	b.IsFailure = IsUpstreamFailure
+	return &BreakerWeather{Provider: p, Breaker: b}
+}
+
+func (c *BreakerWeather) Name() string {
+	return c.Provider.Name()
+}
+
+func (c *BreakerWeather) CurrentWeather(ctx context.Context, address *Address) (*Weather, error) {
+	return guard(ctx, c.Breaker, func(ctx context.Context) (*Weather, error) {
+		return c.Provider.CurrentWeather(ctx, address)
+	})
+}
+
+func (c *BreakerWeather) Forecast(ctx context.Context, address *Address, days int) (*Forecast, error) {
+	return guard(ctx, c.Breaker, func(ctx context.Context) (*Forecast, error) {
+		return c.Provider.Forecast(ctx, address, days)
+	})
+}
+
+func (c *BreakerWeather) History(ctx context.Context, address *Address, date time.Time) (*History, error) {
+	return guard(ctx, c.Breaker, func(ctx context.Context) (*History, error) {
+		return c.Provider.History(ctx, address, date)
+	})
+}
+
+// guard runs call through b
+func guard[T any](ctx context.Context, b *breaker.Breaker, call func(context.Context) (T, error)) (T, error) {
+	var result T
+	err := b.Do(ctx, func(ctx context.Context) (err error) {
+		result, err = call(ctx)
+		return err
+	})
+	return result, err
+}
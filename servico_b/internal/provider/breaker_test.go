@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"servico_b/internal/breaker"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestBreakerCepFailsFastWhileOpen(t *testing.T) {
+	var viacepCalls int32
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/viacep/01001000":
+			atomic.AddInt32(&viacepCalls, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/awesomeapi/01001000":
+			w.Write([]byte(`{"cep": "01001000", "state": "SP", "city": "São Paulo"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer serverMock.Close()
+
+	b, err := breaker.New(ViaCepName, breaker.Settings{FailureThreshold: 2, OpenTimeout: time.Minute}, otel.Meter("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	chain := NewCepChain(tracer, time.Second,
+		NewBreakerCep(NewViaCep(serverMock.URL+"/viacep/%s", nil), b),
+		NewAwesomeAPI(serverMock.URL+"/awesomeapi/%s", nil),
+	)
+
+	for i := 0; i < 4; i++ {
+		address, err := chain.LookupCep(context.Background(), "01001000")
+		assert.NoError(t, err)
+		assert.Equal(t, AwesomeAPIName, address.Provider)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&viacepCalls))
+	assert.Equal(t, breaker.Open, b.State())
+
+	spans := providerSpans(recorder)
+	last := spans[len(spans)-2]
+	assert.Contains(t, last.Attributes(), attribute.String("provider.outcome", "circuit_open"))
+}
+
+func TestBreakerCepIgnoresNotFound(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"erro": true}`))
+	}))
+	defer serverMock.Close()
+
+	b, err := breaker.New(ViaCepName, breaker.Settings{FailureThreshold: 1}, otel.Meter("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewBreakerCep(NewViaCep(serverMock.URL+"/%s", nil), b)
+
+	for i := 0; i < 3; i++ {
+		_, err := p.LookupCep(context.Background(), "00000000")
+		assert.ErrorIs(t, err, ErrCepNotFound)
+	}
+	assert.Equal(t, breaker.Closed, b.State())
+}
@@ -0,0 +1,229 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"servico_b/internal/cache"
+	"servico_b/internal/i18n"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CepKeyPrefix starts the cache keys of CachedCep, followed by the 8 digits of
+// the CEP
+const CepKeyPrefix = "cep:"
+
+// cepEntry is what CachedCep keeps for each CEP, NotFound marks CEPs that do not exist
+type cepEntry struct {
+	Address  *Address `json:"address,omitempty"`
+	NotFound bool     `json:"not_found,omitempty"`
+}
+
+// CachedCep keeps the answers of a CepProvider in a cache, including the not
+// found ones, which are kept for the shorter NegativeTTL
+type CachedCep struct {
+	Provider    CepProvider
+	Cache       cache.Cache
+	TTL         time.Duration
+	NegativeTTL time.Duration
+}
+
+// NewCachedCep wraps p with a cache
+func NewCachedCep(p CepProvider, c cache.Cache, ttl, negativeTTL time.Duration) *CachedCep {
+	return &CachedCep{Provider: p, Cache: c, TTL: ttl, NegativeTTL: negativeTTL}
+}
+
+func (c *CachedCep) Name() string {
+	return c.Provider.Name()
+}
+
+func (c *CachedCep) LookupCep(ctx context.Context, cep string) (*Address, error) {
+	cep, err := ParseCep(cep)
+	if err != nil {
+		return nil, err
+	}
+	span := trace.SpanFromContext(ctx)
+	key := CepKeyPrefix + cep
+
+	var e cepEntry
+	if getEntry(ctx, c.Cache, key, &e) {
+		span.SetAttributes(attribute.String("cache.status", "hit"))
+		if e.NotFound || e.Address == nil {
+			return nil, ErrCepNotFound
+		}
+		e.Address.CacheStatus = "hit"
+		return e.Address, nil
+	}
+	span.SetAttributes(attribute.String("cache.status", "miss"))
+
+	address, err := c.Provider.LookupCep(ctx, cep)
+	switch {
+	case err == nil:
+		if !address.GeocodeFailed {
+			setEntry(ctx, c.Cache, key, cepEntry{Address: address}, c.TTL)
+		}
+		address.CacheStatus = "miss"
+	case errors.Is(err, ErrCepNotFound):
+		setEntry(ctx, c.Cache, key, cepEntry{NotFound: true}, c.NegativeTTL)
+	}
+	return address, err
+}
+
+// weatherEntry is what CachedWeather keeps for each locality
+type weatherEntry struct {
+	Weather       Weather   `json:"weather"`
+	FetchedAt     time.Time `json:"fetched_at"`
+	RefreshFailed bool      `json:"refresh_failed,omitempty"`
+}
+
+// CachedWeather keeps the current weather of each locality in a cache. Entries
+// are fresh for TTL; after that, and for up to StaleTTL more, they are still
+// served right away while a background refresh fetches a new value.
+type CachedWeather struct {
+	Provider       WeatherProvider
+	Cache          cache.Cache
+	TTL            time.Duration
+	StaleTTL       time.Duration
+	RefreshTimeout time.Duration
+
+	mu         sync.Mutex
+	refreshing map[string]bool
+	now        func() time.Time
+}
+
+// NewCachedWeather wraps p with a cache
+func NewCachedWeather(p WeatherProvider, c cache.Cache, ttl, staleTTL time.Duration) *CachedWeather {
+	return &CachedWeather{
+		Provider:       p,
+		Cache:          c,
+		TTL:            ttl,
+		StaleTTL:       staleTTL,
+		RefreshTimeout: 10 * time.Second,
+		refreshing:     make(map[string]bool),
+		now:            time.Now,
+	}
+}
+
+func (c *CachedWeather) Name() string {
+	return c.Provider.Name()
+}
+
+func (c *CachedWeather) CurrentWeather(ctx context.Context, address *Address) (*Weather, error) {
+	span := trace.SpanFromContext(ctx)
+	key := weatherKey(ctx, address)
+
+	var e weatherEntry
+	if getEntry(ctx, c.Cache, key, &e) {
+		weather := e.Weather
+		if c.now().Sub(e.FetchedAt) < c.TTL {
+			span.SetAttributes(attribute.String("cache.status", "hit"))
+			weather.CacheStatus = "hit"
+			return &weather, nil
+		}
+
+		span.SetAttributes(attribute.String("cache.status", "stale"))
+		weather.CacheStatus = "stale"
+		weather.Stale = true
+		weather.RevalidationFailed = e.RefreshFailed
+		c.refresh(ctx, key, address, e)
+		return &weather, nil
+	}
+	span.SetAttributes(attribute.String("cache.status", "miss"))
+
+	weather, err := c.Provider.CurrentWeather(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	c.store(ctx, key, weatherEntry{Weather: *weather, FetchedAt: c.now()})
+	weather.CacheStatus = "miss"
+	return weather, nil
+}
+
+// Forecast is not cached, it goes straight to the wrapped provider
+func (c *CachedWeather) Forecast(ctx context.Context, address *Address, days int) (*Forecast, error) {
+	return c.Provider.Forecast(ctx, address, days)
+}
+
+// History is not cached, it goes straight to the wrapped provider
+func (c *CachedWeather) History(ctx context.Context, address *Address, date time.Time) (*History, error) {
+	return c.Provider.History(ctx, address, date)
+}
+
+// refresh fetches a new value for key in the background, unless a refresh for
+// it is already running. The request context only lends its trace: the refresh
+// outlives the request that triggered it.
+func (c *CachedWeather) refresh(ctx context.Context, key string, address *Address, stale weatherEntry) {
+	c.mu.Lock()
+	if c.refreshing[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[key] = true
+	c.mu.Unlock()
+
+	ctx = context.WithoutCancel(ctx)
+	addr := *address
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, key)
+			c.mu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(ctx, c.RefreshTimeout)
+		defer cancel()
+
+		weather, err := c.Provider.CurrentWeather(ctx, &addr)
+		if err != nil {
+			stale.RefreshFailed = true
+			c.store(ctx, key, stale)
+			return
+		}
+		c.store(ctx, key, weatherEntry{Weather: *weather, FetchedAt: c.now()})
+	}()
+}
+
+// store keeps e until it is too old to be served even as stale
+func (c *CachedWeather) store(ctx context.Context, key string, e weatherEntry) {
+	ttl := e.FetchedAt.Add(c.TTL + c.StaleTTL).Sub(c.now())
+	setEntry(ctx, c.Cache, key, e, ttl)
+}
+
+// getEntry decodes the value cached under key into out. A failing cache is
+// treated as a miss so the lookup still reaches the providers.
+func getEntry(ctx context.Context, c cache.Cache, key string, out interface{}) bool {
+	value, ok, err := c.Get(ctx, key)
+	if err != nil || !ok {
+		return false
+	}
+	return json.Unmarshal(value, out) == nil
+}
+
+// setEntry encodes and caches e, errors are ignored as caching is best effort
+func setEntry(ctx context.Context, c cache.Cache, key string, e interface{}, ttl time.Duration) {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	c.Set(ctx, key, value, ttl)
+}
+
+// weatherKey groups addresses by point, rounded to about a kilometer, or by
+// locality when there are no coordinates. Condition texts are translated, so
+// other languages than the default get entries of their own.
+func weatherKey(ctx context.Context, address *Address) string {
+	key := "weather:" + strings.ToLower(address.Localidade) + "/" + strings.ToUpper(address.UF)
+	if address.HasCoordinates() {
+		key = fmt.Sprintf("weather:%.2f,%.2f", address.Latitude, address.Longitude)
+	}
+	if lang := i18n.FromContext(ctx); lang != i18n.Default {
+		key += "@" + lang.String()
+	}
+	return key
+}
@@ -0,0 +1,177 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"servico_b/internal/cache"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestCachedCep(t *testing.T) {
+	calls := map[string]int{}
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls[r.URL.Path]++
+		if r.URL.Path == "/01001000" {
+			w.Write([]byte(`{"localidade": "São Paulo", "uf": "SP"}`))
+			return
+		}
+		w.Write([]byte(`{"erro": true}`))
+	}))
+	defer serverMock.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	cached := NewCachedCep(NewViaCep(serverMock.URL+"/%s", nil), cache.NewMemory(10), time.Hour, time.Minute)
+
+	lookup := func(cep string) (*Address, error) {
+		ctx, span := tracer.Start(context.Background(), "getCEP")
+		defer span.End()
+		return cached.LookupCep(ctx, cep)
+	}
+
+	for _, cep := range []string{"01001000", "01001-000", "01001000"} {
+		address, err := lookup(cep)
+		assert.NoError(t, err)
+		assert.Equal(t, "São Paulo", address.Localidade)
+	}
+	assert.Equal(t, 1, calls["/01001000"])
+
+	for i := 0; i < 2; i++ {
+		_, err := lookup("99999999")
+		assert.ErrorIs(t, err, ErrCepNotFound)
+	}
+	assert.Equal(t, 1, calls["/99999999"])
+
+	// um CEP inválido não chega ao cache nem ao provedor, haja ou não entrada
+	// com os mesmos dígitos
+	for _, cep := range []string{"abc01001000", "", "0100100"} {
+		_, err := lookup(cep)
+		assert.ErrorIs(t, err, ErrInvalidCep, cep)
+	}
+	assert.Len(t, calls, 2)
+
+	var statuses []string
+	for _, span := range recorder.Ended() {
+		for _, kv := range span.Attributes() {
+			if kv.Key == "cache.status" {
+				statuses = append(statuses, kv.Value.AsString())
+			}
+		}
+	}
+	assert.Equal(t, []string{"miss", "hit", "hit", "miss", "hit"}, statuses)
+}
+
+func TestCachedCepDoesNotCacheFailures(t *testing.T) {
+	calls := 0
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer serverMock.Close()
+
+	cached := NewCachedCep(NewViaCep(serverMock.URL+"/%s", nil), cache.NewMemory(10), time.Hour, time.Minute)
+	for i := 0; i < 2; i++ {
+		_, err := cached.LookupCep(context.Background(), "01001000")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestCachedWeatherStaleWhileRevalidate(t *testing.T) {
+	var mu sync.Mutex
+	temp, status := 20.0, http.StatusOK
+	calls := 0
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"current": {"temp_c": %v, "temp_f": 0}}`, temp)
+	}))
+	defer serverMock.Close()
+
+	now := time.Now()
+	cached := NewCachedWeather(NewWeatherAPI(serverMock.URL+"?q=%s", nil), cache.NewMemory(10), time.Minute, time.Hour)
+	cached.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	address := &Address{Localidade: "São Paulo", UF: "SP"}
+	setUpstream := func(newTemp float64, newStatus int, advance time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		temp, status = newTemp, newStatus
+		now = now.Add(advance)
+	}
+	callCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+
+	weather, err := cached.CurrentWeather(context.Background(), address)
+	assert.NoError(t, err)
+	assert.Equal(t, 20.0, weather.TempC)
+
+	// fresh entries do not reach the upstream
+	setUpstream(25.0, http.StatusOK, 30*time.Second)
+	weather, _ = cached.CurrentWeather(context.Background(), address)
+	assert.Equal(t, 20.0, weather.TempC)
+	assert.False(t, weather.Stale)
+	assert.Equal(t, 1, callCount())
+
+	// stale entries are served right away and refreshed in the background
+	setUpstream(25.0, http.StatusOK, time.Minute)
+	weather, _ = cached.CurrentWeather(context.Background(), address)
+	assert.Equal(t, 20.0, weather.TempC)
+	assert.True(t, weather.Stale)
+	assert.False(t, weather.RevalidationFailed)
+	assert.Eventually(t, func() bool {
+		weather, _ := cached.CurrentWeather(context.Background(), address)
+		return weather.TempC == 25.0 && !weather.Stale
+	}, time.Second, 10*time.Millisecond)
+
+	// with the upstream down the stale value keeps being served, flagged as such
+	setUpstream(30.0, http.StatusServiceUnavailable, 2*time.Minute)
+	weather, _ = cached.CurrentWeather(context.Background(), address)
+	assert.True(t, weather.Stale)
+	assert.Eventually(t, func() bool {
+		weather, _ := cached.CurrentWeather(context.Background(), address)
+		return weather.TempC == 25.0 && weather.Stale && weather.RevalidationFailed
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCachedCepSharedThroughRedis(t *testing.T) {
+	calls := 0
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"localidade": "Guarulhos", "uf": "SP"}`))
+	}))
+	defer serverMock.Close()
+
+	mr := miniredis.RunT(t)
+	newReplica := func() *CachedCep {
+		shared := cache.NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+		return NewCachedCep(NewViaCep(serverMock.URL+"/%s", nil), shared, time.Hour, time.Minute)
+	}
+
+	address, err := newReplica().LookupCep(context.Background(), "07096240")
+	assert.NoError(t, err)
+	assert.Equal(t, "Guarulhos", address.Localidade)
+
+	address, err = newReplica().LookupCep(context.Background(), "07096-240")
+	assert.NoError(t, err)
+	assert.Equal(t, &Address{CEP: "07096240", Localidade: "Guarulhos", UF: "SP", Provider: ViaCepName, CacheStatus: "hit"}, address)
+	assert.Equal(t, 1, calls)
+}
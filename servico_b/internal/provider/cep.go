@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	ViaCepName     = "viacep"
+	BrasilAPIName  = "brasilapi"
+	AwesomeAPIName = "awesomeapi"
+)
+
+var (
+	// ErrCepNotFound is returned by a CepProvider when the CEP does not exist
+	ErrCepNotFound = errors.New("can not find zip code")
+	// ErrInvalidCep is returned for a CEP that is not 8 digits
+	ErrInvalidCep = errors.New("invalid zipcode")
+)
+
+// ParseCep returns the 8 digits of cep, written as 01001000 or 01001-000, or
+// ErrInvalidCep. CEPs are parsed once, before the cache and the providers, so
+// both see the same CEP and nothing else reaches the provider urls.
+func ParseCep(cep string) (string, error) {
+	cep = strings.TrimSpace(cep)
+	if len(cep) == 9 && cep[5] == '-' {
+		cep = cep[:5] + cep[6:]
+	}
+	if len(cep) != 8 {
+		return "", ErrInvalidCep
+	}
+	for _, r := range cep {
+		if r < '0' || r > '9' {
+			return "", ErrInvalidCep
+		}
+	}
+	return cep, nil
+}
+
+// Address is the normalized result of a CEP lookup, whatever backend served it
+type Address struct {
+	CEP        string  `json:"cep"`
+	Localidade string  `json:"localidade"`
+	UF         string  `json:"uf"`
+	IBGE       string  `json:"ibge,omitempty"`
+	Latitude   float64 `json:"lat,omitempty"`
+	Longitude  float64 `json:"lon,omitempty"`
+	Provider   string  `json:"provider"`
+
+	// CacheStatus is set by CachedCep: hit, or miss when the providers were asked
+	CacheStatus string `json:"-"`
+	// GeocodeFailed is set by GeocodedCep when the coordinates could not be
+	// looked up, so CachedCep does not keep the address without them
+	GeocodeFailed bool `json:"-"`
+}
+
+// HasCoordinates reports whether the address was resolved to a point
+func (a *Address) HasCoordinates() bool {
+	return a.Latitude != 0 || a.Longitude != 0
+}
+
+// CepProvider resolves a CEP into an Address
+type CepProvider interface {
+	Name() string
+	LookupCep(ctx context.Context, cep string) (*Address, error)
+}
+
+// NewCepProviders builds the CEP providers listed in names, keeping their order.
+// urls optionally overrides the endpoint template of a provider by name.
+func NewCepProviders(names []string, urls map[string]string, client *http.Client) ([]CepProvider, error) {
+	var providers []CepProvider
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		switch name {
+		case ViaCepName:
+			providers = append(providers, NewViaCep(urls[name], client))
+		case BrasilAPIName:
+			providers = append(providers, NewBrasilAPI(urls[name], client))
+		case AwesomeAPIName:
+			providers = append(providers, NewAwesomeAPI(urls[name], client))
+		default:
+			return nil, fmt.Errorf("unknown cep provider %q", name)
+		}
+	}
+	if len(providers) == 0 {
+		return nil, errors.New("no cep provider configured")
+	}
+	return providers, nil
+}
+
+// parseCoordinate parses the coordinates some providers send as strings,
+// returning 0 (unknown) when they are missing or malformed
+func parseCoordinate(s string) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
@@ -0,0 +1,148 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"servico_b/internal/cache"
+	"servico_b/internal/httpclient"
+	"servico_b/internal/secret"
+	"servico_b/internal/tracing"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestCepProvidersNormalizeAddress(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/viacep/01001000":
+			w.Write([]byte(`{"cep": "01001-000", "localidade": "São Paulo", "uf": "SP", "ibge": "3550308"}`))
+		case "/brasilapi/01001000":
+			w.Write([]byte(`{"cep": "01001000", "state": "SP", "city": "São Paulo", "location": {"type": "Point", "coordinates": {"longitude": "-46.6339", "latitude": "-23.5507"}}}`))
+		case "/awesomeapi/01001000":
+			w.Write([]byte(`{"cep": "01001000", "state": "SP", "city": "São Paulo", "city_ibge": "3550308", "lat": "-23.5507", "lng": "-46.6339"}`))
+		case "/viacep/99999999":
+			w.Write([]byte(`{"erro": "true"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer serverMock.Close()
+
+	providers, err := NewCepProviders(
+		[]string{"viacep", " BrasilAPI", "awesomeapi "},
+		map[string]string{
+			ViaCepName:     serverMock.URL + "/viacep/%s",
+			BrasilAPIName:  serverMock.URL + "/brasilapi/%s",
+			AwesomeAPIName: serverMock.URL + "/awesomeapi/%s",
+		},
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.Len(t, providers, 3)
+
+	expected := map[string]*Address{
+		ViaCepName:     {CEP: "01001000", Localidade: "São Paulo", UF: "SP", IBGE: "3550308", Provider: ViaCepName},
+		BrasilAPIName:  {CEP: "01001000", Localidade: "São Paulo", UF: "SP", Latitude: -23.5507, Longitude: -46.6339, Provider: BrasilAPIName},
+		AwesomeAPIName: {CEP: "01001000", Localidade: "São Paulo", UF: "SP", IBGE: "3550308", Latitude: -23.5507, Longitude: -46.6339, Provider: AwesomeAPIName},
+	}
+	for _, p := range providers {
+		address, err := p.LookupCep(context.Background(), "01001000")
+		assert.NoError(t, err, p.Name())
+		assert.Equal(t, expected[p.Name()], address)
+
+		_, err = p.LookupCep(context.Background(), "99999999")
+		assert.ErrorIs(t, err, ErrCepNotFound, p.Name())
+	}
+}
+
+func TestCepProviderUpstreamError(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer serverMock.Close()
+
+	_, err := NewViaCep(serverMock.URL+"/%s", nil).LookupCep(context.Background(), "01001000")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrCepNotFound)
+	assert.True(t, hasStatus(err, http.StatusBadGateway))
+}
+
+func TestNewCepProvidersUnknown(t *testing.T) {
+	_, err := NewCepProviders([]string{"correios"}, nil, nil)
+	assert.Error(t, err)
+
+	_, err = NewCepProviders([]string{""}, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestParseCep(t *testing.T) {
+	for cep, want := range map[string]string{
+		"01001000":    "01001000",
+		" 01001-000 ": "01001000",
+		"abc01001000": "",
+		"0100-1000":   "",
+		"01001.000":   "",
+		"010010000":   "",
+		"":            "",
+	} {
+		got, err := ParseCep(cep)
+		assert.Equal(t, want, got, cep)
+		if want == "" {
+			assert.ErrorIs(t, err, ErrInvalidCep, cep)
+		}
+	}
+}
+
+func TestCepSpansHashCeps(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"cep": "01001-000", "localidade": "São Paulo", "uf": "SP"}`))
+	}))
+	defer serverMock.Close()
+	downMock := httptest.NewServer(http.NotFoundHandler())
+	downMock.Close()
+
+	key := []byte("chave")
+	recorder := tracetest.NewInMemoryExporter()
+	exporter := secret.NewExporter(recorder)
+	hashCeps := tracing.NewCepHasher(key, CepKeyPrefix, downMock.URL+"/ws/", serverMock.URL+"/ws/")
+	exporter.Redact = func(s string) string { return hashCeps(secret.Redact(s)) }
+	traceProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := traceProvider.Tracer("test")
+	client := httpclient.New(otelhttp.WithTracerProvider(traceProvider))
+
+	// o primeiro provedor falha com um erro que cita a url
+	chain := NewCepChain(tracer, time.Second,
+		NewViaCep(downMock.URL+"/ws/%s/json/", client),
+		NewViaCep(serverMock.URL+"/ws/%s/json/", client),
+	)
+	cached := NewCachedCep(chain, cache.NewTraced(cache.NewMemory(10), "memory", tracer), time.Hour, time.Minute)
+	_, err := cached.LookupCep(context.Background(), "01001-000")
+	assert.NoError(t, err)
+
+	hashed := tracing.Cep("01001000", key).Value.AsString()
+	var strs []string
+	for _, s := range recorder.GetSpans() {
+		strs = append(strs, s.Name, s.Status.Description)
+		for _, kv := range s.Attributes {
+			strs = append(strs, kv.Value.Emit())
+		}
+		for _, event := range s.Events {
+			for _, kv := range event.Attributes {
+				strs = append(strs, kv.Value.Emit())
+			}
+		}
+	}
+	all := strings.Join(strs, "\n")
+	// nem a url dos provedores, nem a chave do cache, nem os erros levam o cep
+	assert.NotContains(t, all, "01001000")
+	assert.NotContains(t, all, "01001-000")
+	assert.Contains(t, all, "/ws/"+hashed+"/json/")
+	assert.Contains(t, all, "cep:"+hashed)
+}
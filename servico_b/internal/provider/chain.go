@@ -0,0 +1,168 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"servico_b/internal/breaker"
+	"servico_b/internal/metrics"
+	"servico_b/internal/secret"
+	"servico_b/internal/tracing"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CepChain tries each CEP provider in order, failing over to the next one when
+// a provider errors, times out or answers 5xx. A not found answer is final.
+type CepChain struct {
+	Providers []CepProvider
+	Timeout   time.Duration
+	Tracer    trace.Tracer
+	// Metrics gets the latency of each provider attempt, nothing is recorded when nil
+	Metrics *metrics.Metrics
+}
+
+// NewCepChain creates a CepChain, timeout bounds each provider attempt
+func NewCepChain(tracer trace.Tracer, timeout time.Duration, providers ...CepProvider) *CepChain {
+	return &CepChain{Providers: providers, Timeout: timeout, Tracer: tracer}
+}
+
+func (c *CepChain) Name() string {
+	names := make([]string, len(c.Providers))
+	for i, p := range c.Providers {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (c *CepChain) LookupCep(ctx context.Context, cep string) (*Address, error) {
+	var errs []error
+	for _, p := range c.Providers {
+		var address *Address
+		err := attempt(ctx, c.Tracer, c.Metrics, c.Timeout, p.Name(), func(ctx context.Context) (err error) {
+			address, err = p.LookupCep(ctx, cep)
+			return err
+		})
+		if err == nil {
+			return address, nil
+		}
+		if errors.Is(err, ErrCepNotFound) || ctx.Err() != nil {
+			return nil, err
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("all cep providers failed: %w", errors.Join(errs...))
+}
+
+// WeatherChain tries each weather provider in order until one answers. Since
+// every provider geocodes on its own, a location unknown to one of them is
+// also a reason to fail over.
+type WeatherChain struct {
+	Providers []WeatherProvider
+	Timeout   time.Duration
+	Tracer    trace.Tracer
+	// Metrics gets the latency of each provider attempt, nothing is recorded when nil
+	Metrics *metrics.Metrics
+}
+
+// NewWeatherChain creates a WeatherChain, timeout bounds each provider attempt
+func NewWeatherChain(tracer trace.Tracer, timeout time.Duration, providers ...WeatherProvider) *WeatherChain {
+	return &WeatherChain{Providers: providers, Timeout: timeout, Tracer: tracer}
+}
+
+func (c *WeatherChain) Name() string {
+	names := make([]string, len(c.Providers))
+	for i, p := range c.Providers {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (c *WeatherChain) CurrentWeather(ctx context.Context, address *Address) (*Weather, error) {
+	return failover(ctx, c, func(ctx context.Context, p WeatherProvider) (*Weather, error) {
+		return p.CurrentWeather(ctx, address)
+	})
+}
+
+func (c *WeatherChain) Forecast(ctx context.Context, address *Address, days int) (*Forecast, error) {
+	return failover(ctx, c, func(ctx context.Context, p WeatherProvider) (*Forecast, error) {
+		return p.Forecast(ctx, address, days)
+	})
+}
+
+func (c *WeatherChain) History(ctx context.Context, address *Address, date time.Time) (*History, error) {
+	return failover(ctx, c, func(ctx context.Context, p WeatherProvider) (*History, error) {
+		return p.History(ctx, address, date)
+	})
+}
+
+// failover calls each provider of the chain in turn until one of them answers
+func failover[T any](ctx context.Context, c *WeatherChain, call func(context.Context, WeatherProvider) (T, error)) (T, error) {
+	var errs []error
+	for _, p := range c.Providers {
+		var result T
+		err := attempt(ctx, c.Tracer, c.Metrics, c.Timeout, p.Name(), func(ctx context.Context) (err error) {
+			result, err = call(ctx, p)
+			return err
+		})
+		if err == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return result, err
+		}
+		errs = append(errs, err)
+	}
+	var zero T
+	return zero, fmt.Errorf("all weather providers failed: %w", errors.Join(errs...))
+}
+
+// attempt runs call in its own child span, bounded by timeout, recording which
+// provider was tried, how it went and how long it took
+func attempt(ctx context.Context, tracer trace.Tracer, m *metrics.Metrics, timeout time.Duration, name string, call func(context.Context) error) error {
+	ctx, span := tracer.Start(ctx, "provider "+name, trace.WithAttributes(attribute.String("provider.name", name)))
+	defer span.End()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := call(ctx)
+	m.RecordUpstream(ctx, name, outcome(err), time.Since(start))
+	span.SetAttributes(attribute.String("provider.outcome", outcome(err)))
+	tracing.RecordError(span, err)
+	return err
+}
+
+func init() {
+	tracing.RegisterError(ErrCepNotFound, "not_found", true)
+	tracing.RegisterError(ErrInvalidCep, "invalid", true)
+	tracing.RegisterError(ErrLocationNotFound, "not_found", true)
+	tracing.RegisterError(ErrNoData, "no_data", true)
+	tracing.RegisterError(breaker.ErrOpen, "circuit_open", false)
+	tracing.RegisterError(ErrRateLimited, "rate_limited", false)
+	tracing.RegisterError(secret.ErrNoKeys, "no_api_key", false)
+}
+
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, ErrCepNotFound), errors.Is(err, ErrLocationNotFound):
+		return "not_found"
+	case errors.Is(err, breaker.ErrOpen):
+		return "circuit_open"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,136 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// providerSpans leaves out the client spans of the HTTP calls
+func providerSpans(recorder *tracetest.SpanRecorder) []sdktrace.ReadOnlySpan {
+	var spans []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() != trace.SpanKindClient {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func TestCepChainFailover(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/viacep/01001000":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/brasilapi/01001000":
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte(`{"cep": "01001000", "state": "SP", "city": "São Paulo"}`))
+		case "/awesomeapi/01001000":
+			w.Write([]byte(`{"cep": "01001000", "state": "SP", "city": "São Paulo"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer serverMock.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	chain := NewCepChain(tracer, 50*time.Millisecond,
+		NewViaCep(serverMock.URL+"/viacep/%s", nil),
+		NewBrasilAPI(serverMock.URL+"/brasilapi/%s", nil),
+		NewAwesomeAPI(serverMock.URL+"/awesomeapi/%s", nil),
+	)
+
+	address, err := chain.LookupCep(context.Background(), "01001000")
+	assert.NoError(t, err)
+	assert.Equal(t, AwesomeAPIName, address.Provider)
+
+	spans := providerSpans(recorder)
+	assert.Len(t, spans, 3)
+	// cada chamada tem seu span de cliente HTTP, filho do span do provedor
+	parents := map[trace.SpanID]bool{}
+	for _, span := range spans {
+		parents[span.SpanContext().SpanID()] = true
+	}
+	clients := 0
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() == trace.SpanKindClient {
+			clients++
+			assert.True(t, parents[span.Parent().SpanID()], span.Name())
+		}
+	}
+	assert.Equal(t, 3, clients)
+
+	outcomes := map[string]string{}
+	for _, span := range spans {
+		attrs := map[string]string{}
+		for _, kv := range span.Attributes() {
+			attrs[string(kv.Key)] = kv.Value.AsString()
+		}
+		outcomes[attrs["provider.name"]] = attrs["provider.outcome"]
+	}
+	assert.Equal(t, map[string]string{
+		ViaCepName:     "error",
+		BrasilAPIName:  "timeout",
+		AwesomeAPIName: "success",
+	}, outcomes)
+}
+
+func TestCepChainNotFoundIsFinal(t *testing.T) {
+	calls := 0
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer serverMock.Close()
+
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	chain := NewCepChain(tracer, time.Second,
+		NewBrasilAPI(serverMock.URL+"/brasilapi/%s", nil),
+		NewAwesomeAPI(serverMock.URL+"/awesomeapi/%s", nil),
+	)
+
+	_, err := chain.LookupCep(context.Background(), "99999999")
+	assert.ErrorIs(t, err, ErrCepNotFound)
+	assert.Equal(t, 1, calls)
+}
+
+func TestWeatherChainFailover(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/weatherapi":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/geocoding":
+			w.Write([]byte(`{"results": [{"name": "São Paulo", "latitude": -23.5475, "longitude": -46.63611}]}`))
+		case "/forecast":
+			w.Write([]byte(`{"current": {"temperature_2m": 10.0}}`))
+		}
+	}))
+	defer serverMock.Close()
+
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	chain := NewWeatherChain(tracer, time.Second,
+		NewWeatherAPI(serverMock.URL+"/weatherapi?q=%s", nil),
+		NewOpenMeteo(serverMock.URL+"/forecast", serverMock.URL+"/geocoding", nil),
+	)
+
+	weather, err := chain.CurrentWeather(context.Background(), &Address{Localidade: "São Paulo"})
+	assert.NoError(t, err)
+	assert.Equal(t, &Weather{
+		TempC: 10.0, TempF: 50.0, Provider: OpenMeteoName,
+		WindDir: "N", Condition: "Clear sky", FeelsLikeF: 32.0,
+	}, weather)
+
+	chain.Providers = chain.Providers[:1]
+	_, err = chain.CurrentWeather(context.Background(), &Address{Localidade: "São Paulo"})
+	assert.Error(t, err)
+	assert.True(t, hasStatus(err, http.StatusInternalServerError))
+}
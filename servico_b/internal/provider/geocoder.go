@@ -0,0 +1,145 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"servico_b/internal/tracing"
+	"strings"
+	"unicode"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/text/unicode/norm"
+)
+
+// states maps each UF to the state name geocoders use
+var states = map[string]string{
+	"AC": "Acre", "AL": "Alagoas", "AP": "Amapá", "AM": "Amazonas", "BA": "Bahia",
+	"CE": "Ceará", "DF": "Distrito Federal", "ES": "Espírito Santo", "GO": "Goiás",
+	"MA": "Maranhão", "MT": "Mato Grosso", "MS": "Mato Grosso do Sul", "MG": "Minas Gerais",
+	"PA": "Pará", "PB": "Paraíba", "PR": "Paraná", "PE": "Pernambuco", "PI": "Piauí",
+	"RJ": "Rio de Janeiro", "RN": "Rio Grande do Norte", "RS": "Rio Grande do Sul",
+	"RO": "Rondônia", "RR": "Roraima", "SC": "Santa Catarina", "SP": "São Paulo",
+	"SE": "Sergipe", "TO": "Tocantins",
+}
+
+// Geocoder resolves the locality of an address into coordinates
+type Geocoder interface {
+	Geocode(ctx context.Context, address *Address) (lat, lon float64, err error)
+}
+
+type OpenMeteoGeocodingResponse struct {
+	Results []struct {
+		Name      string  `json:"name"`
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+		Admin1    string  `json:"admin1"`
+	} `json:"results"`
+}
+
+// OpenMeteoGeocoder geocodes brazilian localities with the Open-Meteo
+// geocoding api. Results are matched against the address UF, so homonymous
+// municipalities in different states are told apart, and then against the
+// locality name, the first result of the state being only a fallback.
+type OpenMeteoGeocoder struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewOpenMeteoGeocoder creates an OpenMeteoGeocoder for the search endpoint at url
+func NewOpenMeteoGeocoder(url string, client *http.Client) *OpenMeteoGeocoder {
+	if url == "" {
+		url = DefaultOpenMeteoGeocodingURL
+	}
+	return &OpenMeteoGeocoder{URL: url, Client: client}
+}
+
+func (g *OpenMeteoGeocoder) Geocode(ctx context.Context, address *Address) (float64, float64, error) {
+	query := url.Values{}
+	query.Set("name", address.Localidade)
+	query.Set("count", "10")
+	query.Set("language", "pt")
+	query.Set("countryCode", "BR")
+
+	var r OpenMeteoGeocodingResponse
+	if err := getJSON(ctx, g.Client, g.URL+"?"+query.Encode(), &r); err != nil {
+		return 0, 0, fmt.Errorf("openmeteo geocoding: %w", err)
+	}
+
+	// the search also matches prefixes and similar names, so a locality named
+	// like the address wins over the first result of the state
+	state, knownUF := states[strings.ToUpper(address.UF)]
+	locality := foldAccents(address.Localidade)
+	var fallback []float64
+	for _, result := range r.Results {
+		if knownUF && foldAccents(result.Admin1) != foldAccents(state) {
+			continue
+		}
+		if foldAccents(result.Name) == locality {
+			return result.Latitude, result.Longitude, nil
+		}
+		if fallback == nil {
+			fallback = []float64{result.Latitude, result.Longitude}
+		}
+	}
+	if fallback == nil {
+		return 0, 0, ErrLocationNotFound
+	}
+	return fallback[0], fallback[1], nil
+}
+
+// GeocodedCep fills in the coordinates of addresses whose provider did not send them
+type GeocodedCep struct {
+	Provider CepProvider
+	Geocoder Geocoder
+	Tracer   trace.Tracer
+}
+
+// NewGeocodedCep wraps p so its addresses always carry coordinates when g can find them
+func NewGeocodedCep(p CepProvider, g Geocoder, tracer trace.Tracer) *GeocodedCep {
+	return &GeocodedCep{Provider: p, Geocoder: g, Tracer: tracer}
+}
+
+func (c *GeocodedCep) Name() string {
+	return c.Provider.Name()
+}
+
+func (c *GeocodedCep) LookupCep(ctx context.Context, cep string) (*Address, error) {
+	address, err := c.Provider.LookupCep(ctx, cep)
+	if err != nil || address.HasCoordinates() {
+		return address, err
+	}
+
+	ctx, span := c.Tracer.Start(ctx, "geocode", trace.WithAttributes(
+		tracing.LocalityKey.String(address.Localidade),
+		tracing.StateKey.String(address.UF),
+	))
+	defer span.End()
+
+	// sem coordenadas o clima ainda pode ser buscado pelo nome da localidade
+	lat, lon, err := c.Geocoder.Geocode(ctx, address)
+	span.SetAttributes(attribute.String("geocode.outcome", outcome(err)))
+	tracing.RecordError(span, err)
+	switch {
+	case err == nil:
+		address.Latitude, address.Longitude = lat, lon
+	case !errors.Is(err, ErrLocationNotFound):
+		// a falha pode passar, o endereço não deve ficar no cache sem coordenadas
+		address.GeocodeFailed = true
+	}
+	return address, nil
+}
+
+// foldAccents lowercases s and strips its diacritics, so "Piauí" matches "piaui"
+func foldAccents(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,162 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"servico_b/internal/cache"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// bomJesusResults lists some of the brazilian municipalities called Bom Jesus
+const bomJesusResults = `{"results": [
+	{"name": "Bom Jesus", "latitude": -28.66806, "longitude": -50.42944, "admin1": "Rio Grande do Sul"},
+	{"name": "Bom Jesus", "latitude": -9.07444, "longitude": -44.35861, "admin1": "Piauí"},
+	{"name": "Bom Jesus", "latitude": -26.73306, "longitude": -52.39194, "admin1": "Santa Catarina"}
+]}`
+
+func TestOpenMeteoGeocoderMatchesState(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(bomJesusResults))
+	}))
+	defer serverMock.Close()
+
+	geocoder := NewOpenMeteoGeocoder(serverMock.URL, nil)
+
+	lat, lon, err := geocoder.Geocode(context.Background(), &Address{Localidade: "Bom Jesus", UF: "PI"})
+	assert.NoError(t, err)
+	assert.Equal(t, -9.07444, lat)
+	assert.Equal(t, -44.35861, lon)
+
+	lat, _, err = geocoder.Geocode(context.Background(), &Address{Localidade: "Bom Jesus", UF: "sc"})
+	assert.NoError(t, err)
+	assert.Equal(t, -26.73306, lat)
+
+	_, _, err = geocoder.Geocode(context.Background(), &Address{Localidade: "Bom Jesus", UF: "GO"})
+	assert.ErrorIs(t, err, ErrLocationNotFound)
+}
+
+func TestGeocodedCepQueriesWeatherByCoordinates(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/viacep/64900000":
+			w.Write([]byte(`{"cep": "64900-000", "localidade": "Bom Jesus", "uf": "PI", "ibge": "2201903"}`))
+		case "/geocoding":
+			w.Write([]byte(bomJesusResults))
+		case "/weatherapi":
+			if r.URL.Query().Get("q") != "-9.0744,-44.3586" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"current": {"temp_c": 33.0, "temp_f": 91.4}}`))
+		}
+	}))
+	defer serverMock.Close()
+
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	cepProvider := NewGeocodedCep(NewViaCep(serverMock.URL+"/viacep/%s", nil), NewOpenMeteoGeocoder(serverMock.URL+"/geocoding", nil), tracer)
+
+	address, err := cepProvider.LookupCep(context.Background(), "64900000")
+	assert.NoError(t, err)
+	assert.Equal(t, "PI", address.UF)
+	assert.Equal(t, -9.07444, address.Latitude)
+	assert.Equal(t, -44.35861, address.Longitude)
+
+	weather, err := NewWeatherAPI(serverMock.URL+"/weatherapi?q=%s", nil).CurrentWeather(context.Background(), address)
+	assert.NoError(t, err)
+	assert.Equal(t, 33.0, weather.TempC)
+}
+
+func TestGeocodedCepKeepsAddressWithoutCoordinates(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/viacep/64900000":
+			w.Write([]byte(`{"localidade": "Bom Jesus", "uf": "PI"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer serverMock.Close()
+
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	cepProvider := NewGeocodedCep(NewViaCep(serverMock.URL+"/viacep/%s", nil), NewOpenMeteoGeocoder(serverMock.URL+"/geocoding", nil), tracer)
+
+	address, err := cepProvider.LookupCep(context.Background(), "64900000")
+	assert.NoError(t, err)
+	assert.Equal(t, "Bom Jesus", address.Localidade)
+	assert.False(t, address.HasCoordinates())
+}
+
+func TestOpenMeteoGeocoderMatchesName(t *testing.T) {
+	results := `{"results": [
+		{"name": "Bom Jesus de Goiás", "latitude": -18.21722, "longitude": -49.74, "admin1": "Goiás"},
+		{"name": "Bom Jesus", "latitude": -9.07444, "longitude": -44.35861, "admin1": "Piauí"},
+		{"name": "Bom Jesus", "latitude": -15.5, "longitude": -49.1, "admin1": "Goias"}
+	]}`
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") == "Bom Jesus" {
+			w.Write([]byte(results))
+			return
+		}
+		w.Write([]byte(`{"results": [{"name": "Bom Jesus de Goiás", "latitude": -18.21722, "longitude": -49.74, "admin1": "Goiás"}]}`))
+	}))
+	defer serverMock.Close()
+
+	geocoder := NewOpenMeteoGeocoder(serverMock.URL, nil)
+
+	// no mesmo estado o nome igual ao da localidade vence o primeiro resultado
+	lat, lon, err := geocoder.Geocode(context.Background(), &Address{Localidade: "Bom Jesus", UF: "GO"})
+	assert.NoError(t, err)
+	assert.Equal(t, -15.5, lat)
+	assert.Equal(t, -49.1, lon)
+
+	// sem nome igual fica o primeiro resultado do estado
+	lat, _, err = geocoder.Geocode(context.Background(), &Address{Localidade: "Bom Jesus de Goias", UF: "GO"})
+	assert.NoError(t, err)
+	assert.Equal(t, -18.21722, lat)
+}
+
+func TestCachedCepSkipsFailedGeocoding(t *testing.T) {
+	calls := map[string]int{}
+	geocodingStatus := http.StatusInternalServerError
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls[r.URL.Path]++
+		switch r.URL.Path {
+		case "/viacep/64900000":
+			w.Write([]byte(`{"localidade": "Bom Jesus", "uf": "PI"}`))
+		case "/geocoding":
+			if geocodingStatus != http.StatusOK {
+				w.WriteHeader(geocodingStatus)
+				return
+			}
+			w.Write([]byte(`{"results": []}`))
+		}
+	}))
+	defer serverMock.Close()
+
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	cepProvider := NewCachedCep(
+		NewGeocodedCep(NewViaCep(serverMock.URL+"/viacep/%s", nil), NewOpenMeteoGeocoder(serverMock.URL+"/geocoding", nil), tracer),
+		cache.NewMemory(10), time.Hour, time.Minute,
+	)
+	lookup := func() *Address {
+		address, err := cepProvider.LookupCep(context.Background(), "64900000")
+		assert.NoError(t, err)
+		return address
+	}
+
+	// com o geocoding fora do ar o endereço sai sem coordenadas e não fica no cache
+	assert.False(t, lookup().HasCoordinates())
+	assert.Equal(t, "miss", lookup().CacheStatus)
+	assert.Equal(t, 2, calls["/viacep/64900000"])
+
+	// uma localidade que o geocoding não conhece é uma resposta, e fica
+	geocodingStatus = http.StatusOK
+	lookup()
+	assert.Equal(t, "hit", lookup().CacheStatus)
+	assert.Equal(t, 3, calls["/viacep/64900000"])
+}
@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"servico_b/internal/httpclient"
+	"strconv"
+)
+
+// StatusError is returned when an upstream answers with a non 200 status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", e.StatusCode)
+}
+
+// ErrorType classifies the error by the status code the upstream answered
+func (e *StatusError) ErrorType() string {
+	return strconv.Itoa(e.StatusCode)
+}
+
+// hasStatus reports whether err is a StatusError carrying one of codes
+func hasStatus(err error, codes ...int) bool {
+	var se *StatusError
+	if !errors.As(err, &se) {
+		return false
+	}
+	for _, code := range codes {
+		if se.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// getJSON performs a GET on endpoint and decodes the JSON body into out
+func getJSON(ctx context.Context, client *http.Client, endpoint string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		client = httpclient.Default
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"servico_b/internal/httpclient"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned, without calling the upstream, when its rate limit
+// would keep the call waiting longer than allowed
+var ErrRateLimited = errors.New("upstream rate limit exceeded")
+
+// Limiter is a token bucket over the HTTP requests to an upstream, retries and
+// api key rotations included. Requests over the rate wait for a token for up to
+// MaxWait, and fail with ErrRateLimited after that.
+type Limiter struct {
+	Name    string
+	Bucket  *rate.Limiter
+	MaxWait time.Duration
+}
+
+// NewLimiter allows perMinute requests a minute to the upstream name, in
+// bursts of up to burst requests
+func NewLimiter(name string, perMinute float64, burst int, maxWait time.Duration) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{Name: name, Bucket: rate.NewLimiter(rate.Limit(perMinute/60), burst), MaxWait: maxWait}
+}
+
+// Wait blocks until a call is allowed, recording the time waited on the span
+// in ctx. It gives up right away when the wait would exceed MaxWait or the
+// deadline of ctx.
+func (l *Limiter) Wait(ctx context.Context) error {
+	span := trace.SpanFromContext(ctx)
+	reservation := l.Bucket.Reserve()
+	delay := reservation.Delay()
+	limit := l.MaxWait
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < limit {
+		limit = time.Until(deadline)
+	}
+	if !reservation.OK() || delay > limit {
+		reservation.Cancel()
+		span.AddEvent("rate limited", trace.WithAttributes(
+			attribute.String("ratelimit.name", l.Name),
+			attribute.Int64("ratelimit.delay_ms", delay.Milliseconds()),
+		))
+		return fmt.Errorf("%s: %w", l.Name, ErrRateLimited)
+	}
+
+	span.SetAttributes(attribute.Int64("ratelimit.wait_ms", delay.Milliseconds()))
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		reservation.Cancel()
+		return ctx.Err()
+	}
+}
+
+// LimitedCep rate limits the requests of a CepProvider, which must send them
+// through an httpclient transport for the limit to apply
+type LimitedCep struct {
+	Provider CepProvider
+	Limiter  *Limiter
+}
+
+// NewLimitedCep wraps p with l
+func NewLimitedCep(p CepProvider, l *Limiter) *LimitedCep {
+	return &LimitedCep{Provider: p, Limiter: l}
+}
+
+func (c *LimitedCep) Name() string {
+	return c.Provider.Name()
+}
+
+func (c *LimitedCep) LookupCep(ctx context.Context, cep string) (*Address, error) {
+	return c.Provider.LookupCep(httpclient.WithGate(ctx, c.Limiter.Wait), cep)
+}
+
+// LimitedWeather rate limits the requests of a WeatherProvider, all of them
+// drawing from the same bucket. As with LimitedCep, they must go through an
+// httpclient transport.
+type LimitedWeather struct {
+	Provider WeatherProvider
+	Limiter  *Limiter
+}
+
+// NewLimitedWeather wraps p with l
+func NewLimitedWeather(p WeatherProvider, l *Limiter) *LimitedWeather {
+	return &LimitedWeather{Provider: p, Limiter: l}
+}
+
+func (c *LimitedWeather) Name() string {
+	return c.Provider.Name()
+}
+
+func (c *LimitedWeather) CurrentWeather(ctx context.Context, address *Address) (*Weather, error) {
+	return c.Provider.CurrentWeather(httpclient.WithGate(ctx, c.Limiter.Wait), address)
+}
+
+func (c *LimitedWeather) Forecast(ctx context.Context, address *Address, days int) (*Forecast, error) {
+	return c.Provider.Forecast(httpclient.WithGate(ctx, c.Limiter.Wait), address, days)
+}
+
+func (c *LimitedWeather) History(ctx context.Context, address *Address, date time.Time) (*History, error) {
+	return c.Provider.History(httpclient.WithGate(ctx, c.Limiter.Wait), address, date)
+}
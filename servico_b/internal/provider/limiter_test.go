@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"servico_b/internal/httpclient"
+	"servico_b/internal/retry"
+	"servico_b/internal/secret"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestLimiterRejectsOverRate(t *testing.T) {
+	l := NewLimiter(WeatherAPIName, 60, 1, 0)
+
+	assert.NoError(t, l.Wait(context.Background()))
+	assert.ErrorIs(t, l.Wait(context.Background()), ErrRateLimited)
+}
+
+func TestLimiterQueuesUpToMaxWait(t *testing.T) {
+	// 600 por minuto, um token a cada 100ms
+	l := NewLimiter(WeatherAPIName, 600, 1, time.Second)
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	assert.NoError(t, l.Wait(context.Background()))
+
+	ctx, span := tracer.Start(context.Background(), "provider weatherapi")
+	start := time.Now()
+	assert.NoError(t, l.Wait(ctx))
+	span.End()
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	var waited int64
+	for _, kv := range recorder.Ended()[0].Attributes() {
+		if kv.Key == "ratelimit.wait_ms" {
+			waited = kv.Value.AsInt64()
+		}
+	}
+	assert.Greater(t, waited, int64(50))
+
+	// o prazo da requisição também limita a espera
+	l.Wait(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Wait(ctx), ErrRateLimited)
+}
+
+func TestLimitedWeatherFailsOver(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/weatherapi":
+			w.Write([]byte(`{"current": {"temp_c": 25.0, "temp_f": 77.0}}`))
+		case "/forecast":
+			w.Write([]byte(`{"current": {"temperature_2m": 10.0}}`))
+		}
+	}))
+	defer serverMock.Close()
+
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	chain := NewWeatherChain(tracer, time.Second,
+		NewLimitedWeather(NewWeatherAPI(serverMock.URL+"/weatherapi?q=%s", nil), NewLimiter(WeatherAPIName, 1, 1, 0)),
+		NewOpenMeteo(serverMock.URL+"/forecast", "", nil),
+	)
+	address := &Address{Localidade: "Guarulhos", UF: "SP", Latitude: -23.46, Longitude: -46.53}
+
+	weather, err := chain.CurrentWeather(context.Background(), address)
+	assert.NoError(t, err)
+	assert.Equal(t, WeatherAPIName, weather.Provider)
+
+	weather, err = chain.CurrentWeather(context.Background(), address)
+	assert.NoError(t, err)
+	assert.Equal(t, OpenMeteoName, weather.Provider)
+}
+
+func TestLimiterCountsEveryAttempt(t *testing.T) {
+	var calls int32
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer serverMock.Close()
+
+	client := &http.Client{Transport: retry.NewTransport(httpclient.NewTransport(nil), retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond})}
+	viaCep := NewLimitedCep(NewViaCep(serverMock.URL+"/%s", client), NewLimiter(ViaCepName, 60, 2, 0))
+
+	// as retentativas também tiram fichas do balde: só 2 das 3 tentativas saem
+	_, err := viaCep.LookupCep(context.Background(), "01001000")
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	_, err = viaCep.LookupCep(context.Background(), "01001000")
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestLimiterCountsKeyRotations(t *testing.T) {
+	var calls int32
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer serverMock.Close()
+
+	weatherAPI := NewWeatherAPI(serverMock.URL+"/v1/current.json?q=%s", nil)
+	weatherAPI.Keys = secret.NewKeyring(WeatherAPIName, []string{"k1", "k2", "k3"}, time.Hour)
+	limited := NewLimitedWeather(weatherAPI, NewLimiter(WeatherAPIName, 60, 2, 0))
+
+	// a troca de chave é mais uma requisição ao weatherapi
+	_, err := limited.CurrentWeather(context.Background(), &Address{Localidade: "Guarulhos", UF: "SP"})
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,222 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"servico_b/internal/i18n"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultOpenMeteoURL          = "https://api.open-meteo.com/v1/forecast"
+	DefaultOpenMeteoGeocodingURL = "https://geocoding-api.open-meteo.com/v1/search"
+	DefaultOpenMeteoArchiveURL   = "https://archive-api.open-meteo.com/v1/archive"
+)
+
+type OpenMeteoResponse struct {
+	Current struct {
+		Time                int64   `json:"time"`
+		Temperature         float64 `json:"temperature_2m"`
+		RelativeHumidity    float64 `json:"relative_humidity_2m"`
+		ApparentTemperature float64 `json:"apparent_temperature"`
+		WeatherCode         int     `json:"weather_code"`
+		WindSpeed           float64 `json:"wind_speed_10m"`
+		WindDirection       int     `json:"wind_direction_10m"`
+		PressureMSL         float64 `json:"pressure_msl"`
+		UVIndex             float64 `json:"uv_index"`
+	} `json:"current"`
+}
+
+// openMeteoCurrent lists the current variables asked to Open-Meteo. The
+// pressure is the one at sea level, as WeatherAPI reports it.
+const openMeteoCurrent = "temperature_2m,relative_humidity_2m,apparent_temperature,weather_code," +
+	"wind_speed_10m,wind_direction_10m,pressure_msl,uv_index"
+
+type OpenMeteoDailyResponse struct {
+	Daily struct {
+		Time []string `json:"time"`
+		// null for the days the archive does not have yet, about the last 5
+		TemperatureMax []*float64 `json:"temperature_2m_max"`
+		TemperatureMin []*float64 `json:"temperature_2m_min"`
+		WeatherCode    []*int     `json:"weather_code"`
+	} `json:"daily"`
+}
+
+// wmoConditions describes the WMO weather interpretation codes used by Open-Meteo
+var wmoConditions = map[int]string{
+	0: "Clear sky", 1: "Mainly clear", 2: "Partly cloudy", 3: "Overcast",
+	45: "Fog", 48: "Depositing rime fog",
+	51: "Light drizzle", 53: "Moderate drizzle", 55: "Dense drizzle",
+	56: "Light freezing drizzle", 57: "Dense freezing drizzle",
+	61: "Slight rain", 63: "Moderate rain", 65: "Heavy rain",
+	66: "Light freezing rain", 67: "Heavy freezing rain",
+	71: "Slight snow fall", 73: "Moderate snow fall", 75: "Heavy snow fall", 77: "Snow grains",
+	80: "Slight rain showers", 81: "Moderate rain showers", 82: "Violent rain showers",
+	85: "Slight snow showers", 86: "Heavy snow showers",
+	95: "Thunderstorm", 96: "Thunderstorm with slight hail", 99: "Thunderstorm with heavy hail",
+}
+
+// wmoCondition describes code in the language of ctx
+func wmoCondition(ctx context.Context, code int) string {
+	condition, ok := wmoConditions[code]
+	if !ok {
+		return ""
+	}
+	return i18n.Sprintf(ctx, condition)
+}
+
+// OpenMeteo fetches the current weather from open-meteo.com, which needs no api key
+type OpenMeteo struct {
+	URL        string
+	ArchiveURL string
+	Geocoder   Geocoder
+	Client     *http.Client
+}
+
+// NewOpenMeteo creates an OpenMeteo provider from its forecast and geocoding endpoints
+func NewOpenMeteo(forecastURL, geocodingURL string, client *http.Client) *OpenMeteo {
+	if forecastURL == "" {
+		forecastURL = DefaultOpenMeteoURL
+	}
+	return &OpenMeteo{
+		URL:        forecastURL,
+		ArchiveURL: DefaultOpenMeteoArchiveURL,
+		Geocoder:   NewOpenMeteoGeocoder(geocodingURL, client),
+		Client:     client,
+	}
+}
+
+func (p *OpenMeteo) Name() string {
+	return OpenMeteoName
+}
+
+func (p *OpenMeteo) CurrentWeather(ctx context.Context, address *Address) (*Weather, error) {
+	query, err := p.pointQuery(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	query.Set("current", openMeteoCurrent)
+	query.Set("timeformat", "unixtime")
+
+	var t OpenMeteoResponse
+	if err := getJSON(ctx, p.Client, p.URL+"?"+query.Encode(), &t); err != nil {
+		return nil, fmt.Errorf("openmeteo: %w", err)
+	}
+
+	c := t.Current
+	weather := &Weather{
+		TempC:    c.Temperature,
+		TempF:    celsiusToFahrenheit(c.Temperature),
+		Provider: OpenMeteoName,
+
+		Humidity:   c.RelativeHumidity,
+		WindKph:    c.WindSpeed,
+		WindDegree: c.WindDirection,
+		WindDir:    compassDirection(c.WindDirection),
+		PressureMb: c.PressureMSL,
+		Condition:  wmoCondition(ctx, c.WeatherCode),
+		FeelsLikeC: c.ApparentTemperature,
+		FeelsLikeF: celsiusToFahrenheit(c.ApparentTemperature),
+		UV:         c.UVIndex,
+	}
+	if c.Time > 0 {
+		weather.LastUpdated = time.Unix(c.Time, 0).UTC()
+	}
+	return weather, nil
+}
+
+func (p *OpenMeteo) Forecast(ctx context.Context, address *Address, days int) (*Forecast, error) {
+	query, err := p.pointQuery(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	query.Set("daily", "temperature_2m_max,temperature_2m_min,weather_code")
+	query.Set("forecast_days", strconv.Itoa(days))
+	// days start at midnight where the address is, Brazil spans four timezones
+	query.Set("timezone", "auto")
+
+	var d OpenMeteoDailyResponse
+	if err := getJSON(ctx, p.Client, p.URL+"?"+query.Encode(), &d); err != nil {
+		return nil, fmt.Errorf("openmeteo: %w", err)
+	}
+
+	daily, err := d.days(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("openmeteo: %w", err)
+	}
+	return &Forecast{Days: daily, Provider: OpenMeteoName}, nil
+}
+
+func (p *OpenMeteo) History(ctx context.Context, address *Address, date time.Time) (*History, error) {
+	query, err := p.pointQuery(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	query.Set("daily", "temperature_2m_max,temperature_2m_min,weather_code")
+	query.Set("start_date", date.Format(DateLayout))
+	query.Set("end_date", date.Format(DateLayout))
+	query.Set("timezone", "auto")
+
+	var d OpenMeteoDailyResponse
+	if err := getJSON(ctx, p.Client, p.ArchiveURL+"?"+query.Encode(), &d); err != nil {
+		return nil, fmt.Errorf("openmeteo: %w", err)
+	}
+
+	days, err := d.days(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("openmeteo: %w", err)
+	}
+	if len(days) == 0 {
+		return nil, ErrNoData
+	}
+	return &History{Day: days[0], Provider: OpenMeteoName}, nil
+}
+
+// pointQuery starts an api query for the address coordinates, geocoding the
+// locality when the address has none
+func (p *OpenMeteo) pointQuery(ctx context.Context, address *Address) (url.Values, error) {
+	lat, lon := address.Latitude, address.Longitude
+	if !address.HasCoordinates() {
+		var err error
+		lat, lon, err = p.Geocoder.Geocode(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	query := url.Values{}
+	query.Set("latitude", strconv.FormatFloat(lat, 'f', -1, 64))
+	query.Set("longitude", strconv.FormatFloat(lon, 'f', -1, 64))
+	return query, nil
+}
+
+// days zips the parallel daily arrays of the response. A day without its
+// temperatures is ErrNoData, not a day at 0 °C.
+func (r *OpenMeteoDailyResponse) days(ctx context.Context) ([]DailyWeather, error) {
+	d := r.Daily
+	var days []DailyWeather
+	for i := range d.Time {
+		if i >= len(d.TemperatureMax) || i >= len(d.TemperatureMin) {
+			break
+		}
+		max, min := d.TemperatureMax[i], d.TemperatureMin[i]
+		if max == nil || min == nil {
+			return nil, fmt.Errorf("%s: %w", d.Time[i], ErrNoData)
+		}
+		day := DailyWeather{
+			Date:     d.Time[i],
+			MinTempC: *min,
+			MaxTempC: *max,
+			MinTempF: celsiusToFahrenheit(*min),
+			MaxTempF: celsiusToFahrenheit(*max),
+		}
+		if i < len(d.WeatherCode) && d.WeatherCode[i] != nil {
+			day.Condition = wmoCondition(ctx, *d.WeatherCode[i])
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
@@ -0,0 +1,57 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+const DefaultViaCepURL = "https://viacep.com.br/ws/%s/json/"
+
+type ViaCepResponse struct {
+	Cep        string `json:"cep"`
+	Localidade string `json:"localidade"`
+	Uf         string `json:"uf"`
+	Ibge       string `json:"ibge"`
+}
+
+// ViaCep looks CEPs up on viacep.com.br
+type ViaCep struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewViaCep creates a ViaCep provider, url is a template with a %s for the CEP
+func NewViaCep(url string, client *http.Client) *ViaCep {
+	if url == "" {
+		url = DefaultViaCepURL
+	}
+	return &ViaCep{URL: url, Client: client}
+}
+
+func (p *ViaCep) Name() string {
+	return ViaCepName
+}
+
+func (p *ViaCep) LookupCep(ctx context.Context, cep string) (*Address, error) {
+	var c ViaCepResponse
+	err := getJSON(ctx, p.Client, fmt.Sprintf(p.URL, cep), &c)
+	// viacep answers 400 for malformed CEPs and {"erro": true} for unknown ones
+	if hasStatus(err, http.StatusBadRequest, http.StatusNotFound) {
+		return nil, ErrCepNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("viacep: %w", err)
+	}
+	if c.Localidade == "" {
+		return nil, ErrCepNotFound
+	}
+
+	return &Address{
+		CEP:        cep,
+		Localidade: c.Localidade,
+		UF:         c.Uf,
+		IBGE:       c.Ibge,
+		Provider:   ViaCepName,
+	}, nil
+}
@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"servico_b/internal/secret"
+	"strings"
+	"time"
+)
+
+const (
+	WeatherAPIName = "weatherapi"
+	OpenMeteoName  = "openmeteo"
+
+	// OpenMeteoGeocodingKey and OpenMeteoArchiveKey override the Open-Meteo
+	// geocoding and archive endpoints in NewWeatherProviders
+	OpenMeteoGeocodingKey = "openmeteo_geocoding"
+	OpenMeteoArchiveKey   = "openmeteo_archive"
+
+	// DateLayout is how days are written in requests and responses
+	DateLayout = "2006-01-02"
+)
+
+var (
+	// ErrLocationNotFound is returned by a WeatherProvider that does not know the address locality
+	ErrLocationNotFound = errors.New("can not find location")
+	// ErrNoData is returned when a provider has no weather for the requested day
+	ErrNoData = errors.New("no weather data for the requested day")
+)
+
+// Weather is the normalized current weather, whatever backend served it
+type Weather struct {
+	TempC    float64 `json:"temp_C"`
+	TempF    float64 `json:"temp_F"`
+	Provider string  `json:"provider"`
+
+	// extended conditions, all of them come in the same upstream call
+	Humidity      float64   `json:"humidity"`
+	WindKph       float64   `json:"wind_kph"`
+	WindDegree    int       `json:"wind_degree"`
+	WindDir       string    `json:"wind_dir"`
+	PressureMb    float64   `json:"pressure_mb"`
+	Condition     string    `json:"condition"`
+	ConditionIcon string    `json:"condition_icon,omitempty"`
+	FeelsLikeC    float64   `json:"feelslike_C"`
+	FeelsLikeF    float64   `json:"feelslike_F"`
+	UV            float64   `json:"uv"`
+	LastUpdated   time.Time `json:"last_updated"`
+
+	// Stale is set when the weather comes from an expired cache entry, and
+	// RevalidationFailed when the last attempt to refresh that entry failed
+	Stale              bool `json:"-"`
+	RevalidationFailed bool `json:"-"`
+	// CacheStatus is set by CachedWeather: hit, stale, or miss when the
+	// providers were asked
+	CacheStatus string `json:"-"`
+}
+
+// DailyWeather is the normalized summary of a single day
+type DailyWeather struct {
+	Date      string  `json:"date"`
+	MinTempC  float64 `json:"min_temp_C"`
+	MaxTempC  float64 `json:"max_temp_C"`
+	MinTempF  float64 `json:"min_temp_F"`
+	MaxTempF  float64 `json:"max_temp_F"`
+	Condition string  `json:"condition"`
+}
+
+// Forecast is the normalized daily forecast, starting today
+type Forecast struct {
+	Days     []DailyWeather `json:"days"`
+	Provider string         `json:"provider"`
+}
+
+// History is the normalized weather observed on a past day
+type History struct {
+	Day      DailyWeather `json:"day"`
+	Provider string       `json:"provider"`
+}
+
+// WeatherProvider returns the current, forecast and past weather of an address
+type WeatherProvider interface {
+	Name() string
+	CurrentWeather(ctx context.Context, address *Address) (*Weather, error)
+	Forecast(ctx context.Context, address *Address, days int) (*Forecast, error)
+	History(ctx context.Context, address *Address, date time.Time) (*History, error)
+}
+
+// NewWeatherProviders builds the weather providers listed in names, keeping their order.
+// urls optionally overrides the endpoint of a provider by name, and
+// weatherAPIKeys holds the api keys of weatherapi.
+func NewWeatherProviders(names []string, urls map[string]string, weatherAPIKeys *secret.Keyring, client *http.Client) ([]WeatherProvider, error) {
+	var providers []WeatherProvider
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		switch name {
+		case WeatherAPIName:
+			if weatherAPIKeys == nil || weatherAPIKeys.Len() == 0 {
+				return nil, errors.New("weatherapi needs an api key")
+			}
+			template := urls[name]
+			if template == "" {
+				template = DefaultWeatherAPIURL
+			}
+			p := NewWeatherAPI(template, client)
+			p.Keys = weatherAPIKeys
+			providers = append(providers, p)
+		case OpenMeteoName:
+			p := NewOpenMeteo(urls[name], urls[OpenMeteoGeocodingKey], client)
+			if urls[OpenMeteoArchiveKey] != "" {
+				p.ArchiveURL = urls[OpenMeteoArchiveKey]
+			}
+			providers = append(providers, p)
+		default:
+			return nil, fmt.Errorf("unknown weather provider %q", name)
+		}
+	}
+	if len(providers) == 0 {
+		return nil, errors.New("no weather provider configured")
+	}
+	return providers, nil
+}
+
+func celsiusToFahrenheit(c float64) float64 {
+	return c*1.8 + 32
+}
+
+// compassPoints names the 16 wind directions, clockwise from north
+var compassPoints = []string{
+	"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE",
+	"S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW",
+}
+
+// compassDirection names the wind direction of degrees, as in "SSW"
+func compassDirection(degrees int) string {
+	degrees = ((degrees % 360) + 360) % 360
+	return compassPoints[int((float64(degrees)+11.25)/22.5)%16]
+}
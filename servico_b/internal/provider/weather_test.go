@@ -0,0 +1,333 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"servico_b/internal/i18n"
+	"servico_b/internal/secret"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"golang.org/x/text/language"
+)
+
+func TestWeatherProviders(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/weatherapi":
+			if r.URL.Query().Get("q") != "São Paulo" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"current": {"temp_c": 20.0, "temp_f": 68.0, "humidity": 72, "wind_kph": 11.2,
+				"wind_degree": 200, "wind_dir": "SSW", "pressure_mb": 1016.0, "feelslike_c": 19.5, "feelslike_f": 67.1,
+				"uv": 3.0, "last_updated_epoch": 1719838800,
+				"condition": {"text": "Partly cloudy", "icon": "//cdn.weatherapi.com/weather/64x64/day/116.png"}}}`))
+		case "/geocoding":
+			if r.URL.Query().Get("name") != "São Paulo" {
+				w.Write([]byte(`{}`))
+				return
+			}
+			w.Write([]byte(`{"results": [{"name": "São Paulo", "latitude": -23.5475, "longitude": -46.63611, "admin1": "São Paulo"}]}`))
+		case "/forecast":
+			assert.Equal(t, "-23.5475", r.URL.Query().Get("latitude"))
+			assert.Equal(t, "-46.63611", r.URL.Query().Get("longitude"))
+			assert.Equal(t, "unixtime", r.URL.Query().Get("timeformat"))
+			assert.Contains(t, r.URL.Query().Get("current"), "pressure_msl")
+			w.Write([]byte(`{"current": {"time": 1719838800, "temperature_2m": 20.0, "relative_humidity_2m": 72,
+				"apparent_temperature": 19.5, "weather_code": 2, "wind_speed_10m": 11.2, "wind_direction_10m": 200,
+				"pressure_msl": 1016.0, "uv_index": 3.0}}`))
+		}
+	}))
+	defer serverMock.Close()
+
+	providers, err := NewWeatherProviders(
+		[]string{"weatherapi", "openmeteo"},
+		map[string]string{
+			WeatherAPIName:        serverMock.URL + "/weatherapi?q=%s",
+			OpenMeteoName:         serverMock.URL + "/forecast",
+			OpenMeteoGeocodingKey: serverMock.URL + "/geocoding",
+		},
+		secret.NewKeyring(WeatherAPIName, []string{"mock"}, 0),
+		nil,
+	)
+	assert.NoError(t, err)
+	assert.Len(t, providers, 2)
+
+	lastUpdated := time.Date(2024, 7, 1, 13, 0, 0, 0, time.UTC)
+	expected := map[string]*Weather{
+		WeatherAPIName: {
+			TempC: 20.0, TempF: 68.0, Provider: WeatherAPIName,
+			Humidity: 72, WindKph: 11.2, WindDegree: 200, WindDir: "SSW", PressureMb: 1016.0,
+			Condition: "Partly cloudy", ConditionIcon: "https://cdn.weatherapi.com/weather/64x64/day/116.png",
+			FeelsLikeC: 19.5, FeelsLikeF: 67.1, UV: 3.0, LastUpdated: lastUpdated,
+		},
+		OpenMeteoName: {
+			TempC: 20.0, TempF: 68.0, Provider: OpenMeteoName,
+			Humidity: 72, WindKph: 11.2, WindDegree: 200, WindDir: "SSW", PressureMb: 1016.0,
+			Condition:  "Partly cloudy",
+			FeelsLikeC: 19.5, FeelsLikeF: 67.1, UV: 3.0, LastUpdated: lastUpdated,
+		},
+	}
+
+	for _, p := range providers {
+		weather, err := p.CurrentWeather(context.Background(), &Address{Localidade: "São Paulo", UF: "SP"})
+		assert.NoError(t, err, p.Name())
+		assert.Equal(t, expected[p.Name()], weather)
+
+		_, err = p.CurrentWeather(context.Background(), &Address{Localidade: "Lugar Nenhum"})
+		assert.ErrorIs(t, err, ErrLocationNotFound, p.Name())
+	}
+}
+
+func TestNewWeatherProvidersNeedsWeatherAPIKey(t *testing.T) {
+	_, err := NewWeatherProviders([]string{"weatherapi"}, nil, nil, nil)
+	assert.Error(t, err)
+	_, err = NewWeatherProviders([]string{"weatherapi"}, nil, secret.NewKeyring(WeatherAPIName, nil, 0), nil)
+	assert.Error(t, err)
+
+	providers, err := NewWeatherProviders([]string{"weatherapi", "openmeteo"}, nil,
+		secret.NewKeyring(WeatherAPIName, []string{"mock"}, 0), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultWeatherAPIURL, providers[0].(*WeatherAPI).URL)
+	assert.Equal(t, DefaultOpenMeteoURL, providers[1].(*OpenMeteo).URL)
+}
+
+func TestWeatherProvidersForecast(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/forecast.json":
+			assert.Equal(t, "-23.5475,-46.6361", r.URL.Query().Get("q"))
+			assert.Equal(t, "2", r.URL.Query().Get("days"))
+			assert.Equal(t, "mock", r.URL.Query().Get("key"))
+			w.Write([]byte(`{"forecast": {"forecastday": [
+				{"date": "2024-07-01", "day": {"maxtemp_c": 25.0, "maxtemp_f": 77.0, "mintemp_c": 15.0, "mintemp_f": 59.0, "condition": {"text": "Sunny"}}},
+				{"date": "2024-07-02", "day": {"maxtemp_c": 20.0, "maxtemp_f": 68.0, "mintemp_c": 10.0, "mintemp_f": 50.0, "condition": {"text": "Light rain"}}}
+			]}}`))
+		case "/forecast":
+			assert.Equal(t, "2", r.URL.Query().Get("forecast_days"))
+			assert.Equal(t, "auto", r.URL.Query().Get("timezone"))
+			w.Write([]byte(`{"daily": {
+				"time": ["2024-07-01", "2024-07-02"],
+				"temperature_2m_max": [25.0, 20.0],
+				"temperature_2m_min": [15.0, 10.0],
+				"weather_code": [0, 61]
+			}}`))
+		}
+	}))
+	defer serverMock.Close()
+
+	weatherAPI := NewWeatherAPI(serverMock.URL+"/v1/current.json?q=%s&aqi=no", nil)
+	weatherAPI.Keys = secret.NewKeyring(WeatherAPIName, []string{"mock"}, 0)
+	providers := []WeatherProvider{
+		weatherAPI,
+		NewOpenMeteo(serverMock.URL+"/forecast", "", nil),
+	}
+	address := &Address{Localidade: "São Paulo", UF: "SP", Latitude: -23.5475, Longitude: -46.63611}
+	conditions := map[string][]string{
+		WeatherAPIName: {"Sunny", "Light rain"},
+		OpenMeteoName:  {"Clear sky", "Slight rain"},
+	}
+
+	for _, p := range providers {
+		forecast, err := p.Forecast(context.Background(), address, 2)
+		assert.NoError(t, err, p.Name())
+		assert.Equal(t, p.Name(), forecast.Provider)
+		assert.Equal(t, []DailyWeather{
+			{Date: "2024-07-01", MinTempC: 15.0, MaxTempC: 25.0, MinTempF: 59.0, MaxTempF: 77.0, Condition: conditions[p.Name()][0]},
+			{Date: "2024-07-02", MinTempC: 10.0, MaxTempC: 20.0, MinTempF: 50.0, MaxTempF: 68.0, Condition: conditions[p.Name()][1]},
+		}, forecast.Days, p.Name())
+	}
+}
+
+func TestWeatherProvidersHistory(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/history.json":
+			assert.Equal(t, "2024-07-01", r.URL.Query().Get("dt"))
+			w.Write([]byte(`{"forecast": {"forecastday": [
+				{"date": "2024-07-01", "day": {"maxtemp_c": 25.0, "maxtemp_f": 77.0, "mintemp_c": 15.0, "mintemp_f": 59.0, "condition": {"text": "Sunny"}}}
+			]}}`))
+		case "/archive":
+			assert.Equal(t, "2024-07-01", r.URL.Query().Get("start_date"))
+			assert.Equal(t, "2024-07-01", r.URL.Query().Get("end_date"))
+			w.Write([]byte(`{"daily": {"time": ["2024-07-01"], "temperature_2m_max": [25.0], "temperature_2m_min": [15.0], "weather_code": [0]}}`))
+		}
+	}))
+	defer serverMock.Close()
+
+	providers, err := NewWeatherProviders(
+		[]string{"weatherapi", "openmeteo"},
+		map[string]string{
+			WeatherAPIName:      serverMock.URL + "/v1/current.json?q=%s&aqi=no",
+			OpenMeteoArchiveKey: serverMock.URL + "/archive",
+		},
+		secret.NewKeyring(WeatherAPIName, []string{"mock"}, 0),
+		nil,
+	)
+	assert.NoError(t, err)
+
+	address := &Address{Localidade: "São Paulo", UF: "SP", Latitude: -23.5475, Longitude: -46.63611}
+	date := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	for _, p := range providers {
+		history, err := p.History(context.Background(), address, date)
+		assert.NoError(t, err, p.Name())
+		assert.Equal(t, p.Name(), history.Provider)
+		assert.Equal(t, "2024-07-01", history.Day.Date)
+		assert.Equal(t, 15.0, history.Day.MinTempC)
+		assert.Equal(t, 77.0, history.Day.MaxTempF)
+	}
+}
+
+func TestCompassDirection(t *testing.T) {
+	for degrees, expected := range map[int]string{
+		0: "N", 11: "N", 12: "NNE", 90: "E", 200: "SSW", 348: "NNW", 349: "N", 360: "N", -90: "W",
+	} {
+		assert.Equal(t, expected, compassDirection(degrees), degrees)
+	}
+}
+
+func TestWeatherProvidersLanguage(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/current.json":
+			assert.Equal(t, "pt", r.URL.Query().Get("lang"))
+			assert.Equal(t, "mock", r.URL.Query().Get("key"))
+			w.Write([]byte(`{"current": {"temp_c": 20.0, "condition": {"text": "Parcialmente nublado"}}}`))
+		case "/v1/forecast.json":
+			assert.Equal(t, "pt", r.URL.Query().Get("lang"))
+			w.Write([]byte(`{"forecast": {"forecastday": [{"date": "2024-07-01", "day": {"condition": {"text": "Sol"}}}]}}`))
+		case "/forecast":
+			w.Write([]byte(`{"current": {"temperature_2m": 20.0, "weather_code": 2},
+				"daily": {"time": ["2024-07-01"], "temperature_2m_max": [25.0], "temperature_2m_min": [15.0], "weather_code": [61]}}`))
+		}
+	}))
+	defer serverMock.Close()
+
+	weatherAPI := NewWeatherAPI(serverMock.URL+"/v1/current.json?q=%s&aqi=no", nil)
+	weatherAPI.Keys = secret.NewKeyring(WeatherAPIName, []string{"mock"}, 0)
+	providers := []WeatherProvider{
+		weatherAPI,
+		NewOpenMeteo(serverMock.URL+"/forecast", "", nil),
+	}
+	daily := map[string]string{WeatherAPIName: "Sol", OpenMeteoName: "Chuva fraca"}
+
+	ctx := i18n.WithLanguage(context.Background(), language.BrazilianPortuguese)
+	address := &Address{Localidade: "São Paulo", UF: "SP", Latitude: -23.5475, Longitude: -46.63611}
+	for _, p := range providers {
+		weather, err := p.CurrentWeather(ctx, address)
+		assert.NoError(t, err, p.Name())
+		assert.Equal(t, "Parcialmente nublado", weather.Condition, p.Name())
+
+		forecast, err := p.Forecast(ctx, address, 1)
+		assert.NoError(t, err, p.Name())
+		assert.Equal(t, daily[p.Name()], forecast.Days[0].Condition, p.Name())
+	}
+}
+
+func TestWeatherAPIRotatesKeys(t *testing.T) {
+	var used []string
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("key")
+		used = append(used, key)
+		switch key {
+		case "revoked":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "exhausted":
+			// weatherapi responde 403 quando a cota da chave acaba
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.Write([]byte(`{"current": {"temp_c": 20.0}}`))
+		}
+	}))
+	defer serverMock.Close()
+
+	p := NewWeatherAPI(serverMock.URL+"/v1/current.json?q=%s", nil)
+	p.Keys = secret.NewKeyring(WeatherAPIName, []string{"revoked", "good", "exhausted", "spare"}, time.Hour)
+	address := &Address{Localidade: "São Paulo", UF: "SP"}
+
+	for i := 0; i < 4; i++ {
+		weather, err := p.CurrentWeather(context.Background(), address)
+		assert.NoError(t, err)
+		assert.Equal(t, 20.0, weather.TempC)
+	}
+	// as chaves recusadas saem do rodízio e as boas se alternam
+	assert.Equal(t, []string{"revoked", "good", "exhausted", "spare", "good", "spare"}, used)
+
+	p.Keys = secret.NewKeyring(WeatherAPIName, []string{"revoked", "exhausted"}, time.Hour)
+	_, err := p.CurrentWeather(context.Background(), address)
+	assert.ErrorIs(t, err, secret.ErrNoKeys)
+	assert.NotErrorIs(t, err, ErrLocationNotFound)
+}
+
+func TestWeatherAPIShortForecastFailsOver(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/forecast.json":
+			// o plano gratuito responde no máximo 3 dias
+			w.Write([]byte(`{"forecast": {"forecastday": [
+				{"date": "2024-07-01", "day": {"maxtemp_c": 25.0, "mintemp_c": 15.0}},
+				{"date": "2024-07-02", "day": {"maxtemp_c": 20.0, "mintemp_c": 10.0}},
+				{"date": "2024-07-03", "day": {"maxtemp_c": 21.0, "mintemp_c": 11.0}}
+			]}}`))
+		case "/forecast":
+			w.Write([]byte(`{"daily": {
+				"time": ["2024-07-01", "2024-07-02", "2024-07-03", "2024-07-04", "2024-07-05"],
+				"temperature_2m_max": [25.0, 20.0, 21.0, 22.0, 23.0],
+				"temperature_2m_min": [15.0, 10.0, 11.0, 12.0, 13.0],
+				"weather_code": [0, 61, 0, 0, 0]
+			}}`))
+		}
+	}))
+	defer serverMock.Close()
+
+	chain := NewWeatherChain(sdktrace.NewTracerProvider().Tracer("test"), time.Second,
+		NewWeatherAPI(serverMock.URL+"/v1/current.json?q=%s&aqi=no", nil),
+		NewOpenMeteo(serverMock.URL+"/forecast", "", nil),
+	)
+	address := &Address{Localidade: "São Paulo", UF: "SP", Latitude: -23.5475, Longitude: -46.63611}
+
+	forecast, err := chain.Forecast(context.Background(), address, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, OpenMeteoName, forecast.Provider)
+	assert.Len(t, forecast.Days, 5)
+
+	forecast, err = chain.Forecast(context.Background(), address, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, WeatherAPIName, forecast.Provider)
+}
+
+func TestOpenMeteoNullHistoryFailsOver(t *testing.T) {
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/archive":
+			// o ERA5 leva uns 5 dias para chegar ao arquivo, até lá os dias vêm nulos
+			w.Write([]byte(`{"daily": {"time": ["2024-07-01"], "temperature_2m_max": [null], "temperature_2m_min": [null], "weather_code": [null]}}`))
+		case "/v1/history.json":
+			w.Write([]byte(`{"forecast": {"forecastday": [
+				{"date": "2024-07-01", "day": {"maxtemp_c": 25.0, "mintemp_c": 15.0}}
+			]}}`))
+		}
+	}))
+	defer serverMock.Close()
+
+	openMeteo := NewOpenMeteo(serverMock.URL+"/forecast", "", nil)
+	openMeteo.ArchiveURL = serverMock.URL + "/archive"
+	address := &Address{Localidade: "São Paulo", UF: "SP", Latitude: -23.5475, Longitude: -46.63611}
+	date := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := openMeteo.History(context.Background(), address, date)
+	assert.ErrorIs(t, err, ErrNoData)
+
+	chain := NewWeatherChain(sdktrace.NewTracerProvider().Tracer("test"), time.Second,
+		openMeteo,
+		NewWeatherAPI(serverMock.URL+"/v1/current.json?q=%s&aqi=no", nil),
+	)
+	history, err := chain.History(context.Background(), address, date)
+	assert.NoError(t, err)
+	assert.Equal(t, WeatherAPIName, history.Provider)
+	assert.Equal(t, 15.0, history.Day.MinTempC)
+}
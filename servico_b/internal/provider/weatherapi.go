@@ -0,0 +1,230 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"servico_b/internal/i18n"
+	"servico_b/internal/secret"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultWeatherAPIURL is the current.json template used when none is configured
+const DefaultWeatherAPIURL = "https://api.weatherapi.com/v1/current.json?q=%s&aqi=no"
+
+type WeatherAPIResponse struct {
+	Current struct {
+		Temp_c           float64 `json:"temp_c"`
+		Temp_f           float64 `json:"temp_f"`
+		Humidity         float64 `json:"humidity"`
+		Wind_kph         float64 `json:"wind_kph"`
+		Wind_degree      int     `json:"wind_degree"`
+		Wind_dir         string  `json:"wind_dir"`
+		Pressure_mb      float64 `json:"pressure_mb"`
+		Feelslike_c      float64 `json:"feelslike_c"`
+		Feelslike_f      float64 `json:"feelslike_f"`
+		Uv               float64 `json:"uv"`
+		LastUpdatedEpoch int64   `json:"last_updated_epoch"`
+		Condition        struct {
+			Text string `json:"text"`
+			Icon string `json:"icon"`
+		} `json:"condition"`
+	} `json:"current"`
+}
+
+type WeatherAPIForecastResponse struct {
+	Forecast struct {
+		Forecastday []WeatherAPIForecastDay `json:"forecastday"`
+	} `json:"forecast"`
+}
+
+type WeatherAPIForecastDay struct {
+	Date string `json:"date"`
+	Day  struct {
+		Maxtemp_c float64 `json:"maxtemp_c"`
+		Maxtemp_f float64 `json:"maxtemp_f"`
+		Mintemp_c float64 `json:"mintemp_c"`
+		Mintemp_f float64 `json:"mintemp_f"`
+		Condition struct {
+			Text string `json:"text"`
+		} `json:"condition"`
+	} `json:"day"`
+}
+
+// WeatherAPI fetches weather from weatherapi.com
+type WeatherAPI struct {
+	URL         string
+	ForecastURL string
+	HistoryURL  string
+	Client      *http.Client
+	// Keys holds the api keys, sent as the key parameter. Without it the url
+	// templates are used as they are.
+	Keys *secret.Keyring
+}
+
+// NewWeatherAPI creates a WeatherAPI provider, url is the current.json template
+// with a %s for the location and no api key, which goes in Keys. The
+// forecast.json and history.json templates are derived from it.
+func NewWeatherAPI(url string, client *http.Client) *WeatherAPI {
+	return &WeatherAPI{
+		URL:         url,
+		ForecastURL: strings.Replace(url, "/current.json", "/forecast.json", 1),
+		HistoryURL:  strings.Replace(url, "/current.json", "/history.json", 1),
+		Client:      client,
+	}
+}
+
+func (p *WeatherAPI) Name() string {
+	return WeatherAPIName
+}
+
+func (p *WeatherAPI) CurrentWeather(ctx context.Context, address *Address) (*Weather, error) {
+	var t WeatherAPIResponse
+	if err := p.get(ctx, p.URL, address, nil, &t); err != nil {
+		return nil, err
+	}
+
+	c := t.Current
+	weather := &Weather{
+		TempC:    c.Temp_c,
+		TempF:    c.Temp_f,
+		Provider: WeatherAPIName,
+
+		Humidity:      c.Humidity,
+		WindKph:       c.Wind_kph,
+		WindDegree:    c.Wind_degree,
+		WindDir:       c.Wind_dir,
+		PressureMb:    c.Pressure_mb,
+		Condition:     c.Condition.Text,
+		ConditionIcon: c.Condition.Icon,
+		FeelsLikeC:    c.Feelslike_c,
+		FeelsLikeF:    c.Feelslike_f,
+		UV:            c.Uv,
+	}
+	// weatherapi sends protocol relative icon urls
+	if strings.HasPrefix(weather.ConditionIcon, "//") {
+		weather.ConditionIcon = "https:" + weather.ConditionIcon
+	}
+	if c.LastUpdatedEpoch > 0 {
+		weather.LastUpdated = time.Unix(c.LastUpdatedEpoch, 0).UTC()
+	}
+	return weather, nil
+}
+
+func (p *WeatherAPI) Forecast(ctx context.Context, address *Address, days int) (*Forecast, error) {
+	var f WeatherAPIForecastResponse
+	if err := p.get(ctx, p.ForecastURL, address, url.Values{"days": {strconv.Itoa(days)}}, &f); err != nil {
+		return nil, err
+	}
+
+	// plans cap the days answered, the free one at 3, so a short answer is
+	// left to the next provider instead of being passed off as the forecast
+	if got := len(f.Forecast.Forecastday); got < days {
+		return nil, fmt.Errorf("weatherapi: %d of the %d days asked: %w", got, days, ErrNoData)
+	}
+	forecast := &Forecast{Provider: WeatherAPIName}
+	for _, d := range f.Forecast.Forecastday[:days] {
+		forecast.Days = append(forecast.Days, d.daily())
+	}
+	return forecast, nil
+}
+
+func (p *WeatherAPI) History(ctx context.Context, address *Address, date time.Time) (*History, error) {
+	// the daily endpoints share the forecast response format
+	var f WeatherAPIForecastResponse
+	if err := p.get(ctx, p.HistoryURL, address, url.Values{"dt": {date.Format(DateLayout)}}, &f); err != nil {
+		return nil, err
+	}
+	if len(f.Forecast.Forecastday) == 0 {
+		return nil, ErrNoData
+	}
+	return &History{Day: f.Forecast.Forecastday[0].daily(), Provider: WeatherAPIName}, nil
+}
+
+// get calls the endpoint of template for the address, with the extra query
+// parameters, rotating to the next api key while weatherapi refuses them
+func (p *WeatherAPI) get(ctx context.Context, template string, address *Address, extra url.Values, out interface{}) error {
+	endpoint, err := p.endpoint(ctx, template, address)
+	if err != nil {
+		return err
+	}
+	query := endpoint.Query()
+	for param, values := range extra {
+		query[param] = values
+	}
+
+	for {
+		var key string
+		if p.Keys != nil {
+			if key, err = p.Keys.Key(); err != nil {
+				return fmt.Errorf("weatherapi: %w", err)
+			}
+			query.Set("key", key)
+		}
+		endpoint.RawQuery = query.Encode()
+
+		err = getJSON(ctx, p.Client, endpoint.String(), out)
+		// weatherapi answers 401 for unknown keys and 403 for disabled keys
+		// or keys over their quota
+		var se *StatusError
+		if p.Keys != nil && errors.As(err, &se) && (se.StatusCode == http.StatusUnauthorized || se.StatusCode == http.StatusForbidden) {
+			p.Keys.Reject(key)
+			trace.SpanFromContext(ctx).AddEvent("api key rejected", trace.WithAttributes(
+				attribute.String("apikey.id", p.Keys.ID(key)),
+				attribute.Int("http.response.status_code", se.StatusCode),
+			))
+			continue
+		}
+		break
+	}
+	// weatherapi answers 400 when no location matches the query
+	if hasStatus(err, http.StatusBadRequest) {
+		return ErrLocationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("weatherapi: %w", err)
+	}
+	return nil
+}
+
+// endpoint fills template with the address, asking for condition texts in the
+// language of ctx
+func (p *WeatherAPI) endpoint(ctx context.Context, template string, address *Address) (*url.URL, error) {
+	endpoint, err := url.Parse(fmt.Sprintf(template, url.QueryEscape(weatherAPIQuery(address))))
+	if err != nil {
+		return nil, fmt.Errorf("weatherapi: %w", err)
+	}
+	if lang := i18n.FromContext(ctx); lang != i18n.Default {
+		base, _ := lang.Base()
+		query := endpoint.Query()
+		query.Set("lang", base.String())
+		endpoint.RawQuery = query.Encode()
+	}
+	return endpoint, nil
+}
+
+func (d WeatherAPIForecastDay) daily() DailyWeather {
+	return DailyWeather{
+		Date:      d.Date,
+		MinTempC:  d.Day.Mintemp_c,
+		MaxTempC:  d.Day.Maxtemp_c,
+		MinTempF:  d.Day.Mintemp_f,
+		MaxTempF:  d.Day.Maxtemp_f,
+		Condition: d.Day.Condition.Text,
+	}
+}
+
+// weatherAPIQuery prefers coordinates, as locality names repeat across states
+func weatherAPIQuery(address *Address) string {
+	if address.HasCoordinates() {
+		return strconv.FormatFloat(address.Latitude, 'f', 4, 64) + "," + strconv.FormatFloat(address.Longitude, 'f', 4, 64)
+	}
+	return address.Localidade
+}
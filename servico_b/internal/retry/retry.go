@@ -0,0 +1,189 @@
+// Package retry retries idempotent HTTP calls that failed for transient
+// reasons, with exponential backoff, jitter and support for Retry-After.
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"servico_b/internal/httpclient"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DefaultMaxAttempts = 3
+	DefaultBaseDelay   = 100 * time.Millisecond
+	DefaultMaxDelay    = 2 * time.Second
+)
+
+// Policy tells how many times and how far apart a call is attempted
+type Policy struct {
+	// MaxAttempts counts the first attempt, 1 disables retries
+	MaxAttempts int
+	// BaseDelay is the backoff cap of the first retry, doubling on every retry
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff. A Retry-After longer than it is not waited for.
+	MaxDelay time.Duration
+}
+
+// Backoff returns how long to wait before retry number n (starting at 1):
+// a random duration up to BaseDelay*2^(n-1), capped by MaxDelay ("full jitter")
+func (p Policy) Backoff(n int) time.Duration {
+	ceiling := p.MaxDelay
+	if shift := n - 1; shift < 32 {
+		if d := p.BaseDelay << shift; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// Transport is an http.RoundTripper retrying idempotent requests that failed
+// with a network error or a 429, 502, 503 or 504. No retry is scheduled past
+// the deadline of the request. Base is expected to be instrumented, see
+// httpclient, so every attempt gets its own client span.
+type Transport struct {
+	Base   http.RoundTripper
+	Policy Policy
+
+	sleep func(context.Context, time.Duration) error
+}
+
+// NewTransport wraps base, http.DefaultTransport when nil, with policy
+func NewTransport(base http.RoundTripper, policy Policy) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultMaxAttempts
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = DefaultBaseDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = DefaultMaxDelay
+	}
+	return &Transport{Base: base, Policy: policy, sleep: sleep}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	attempts := t.Policy.MaxAttempts
+	if !idempotent(req) {
+		attempts = 1
+	}
+
+	for n := 0; ; n++ {
+		resp, err := t.attempt(ctx, req, n)
+		if n+1 >= attempts || !retryable(resp, err) {
+			return resp, err
+		}
+
+		delay := t.Policy.Backoff(n + 1)
+		if after, ok := retryAfter(resp); ok {
+			if after > t.Policy.MaxDelay {
+				return resp, err
+			}
+			delay = after
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("http.request.resend_count", n+1),
+			attribute.Int64("retry.delay_ms", delay.Milliseconds()),
+		))
+		if err := t.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends a copy of req, marked with how many times it was resent
+func (t *Transport) attempt(ctx context.Context, req *http.Request, n int) (*http.Response, error) {
+	out := req
+	if n > 0 {
+		out = req.Clone(httpclient.WithResendCount(ctx, n))
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			out.Body = body
+		}
+	}
+	return t.Base.RoundTrip(out)
+}
+
+// idempotent reports whether req can be sent again without side effects
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	default:
+		return false
+	}
+}
+
+// retryable reports whether a failed attempt is worth repeating
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		// the caller giving up, running out of time or the request being held
+		// back by its gate is not transient
+		var gate *httpclient.GateError
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) && !errors.As(err, &gate)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryAfter reads the Retry-After header of resp, in seconds or as a date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		d := time.Until(date)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,164 @@
+package retry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"servico_b/internal/httpclient"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTestClient returns a client retrying through a Transport, over an
+// instrumented one, that records the delays it would sleep instead of sleeping
+func newTestClient(policy Policy) (*http.Client, *tracetest.SpanRecorder, *[]time.Duration) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	transport := NewTransport(httpclient.NewTransport(nil, otelhttp.WithTracerProvider(provider)), policy)
+	var delays []time.Duration
+	transport.sleep = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	return &http.Client{Transport: transport}, recorder, &delays
+}
+
+func TestTransportRetriesTransientFailures(t *testing.T) {
+	var calls int32
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer serverMock.Close()
+
+	client, recorder, delays := newTestClient(Policy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: time.Second})
+	resp, err := client.Get(serverMock.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	resp.Body.Close()
+
+	assert.Len(t, *delays, 2)
+	assert.LessOrEqual(t, (*delays)[0], 10*time.Millisecond)
+	assert.LessOrEqual(t, (*delays)[1], 20*time.Millisecond)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 3)
+	for i, span := range spans {
+		assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+		if i > 0 {
+			assert.Contains(t, span.Attributes(), attribute.Int("http.request.resend_count", i))
+		}
+	}
+	assert.Contains(t, spans[0].Attributes(), attribute.Int("http.response.status_code", http.StatusServiceUnavailable))
+}
+
+func TestTransportGivesUpAfterMaxAttempts(t *testing.T) {
+	var calls int32
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer serverMock.Close()
+
+	client, _, _ := newTestClient(Policy{MaxAttempts: 2})
+	resp, err := client.Get(serverMock.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestTransportDoesNotRetry(t *testing.T) {
+	var calls int32
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer serverMock.Close()
+
+	client, _, _ := newTestClient(Policy{MaxAttempts: 3})
+
+	// 404 não é transitório
+	resp, err := client.Get(serverMock.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// POST não é idempotente
+	resp, err = client.Post(serverMock.URL, "application/json", strings.NewReader(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestTransportHonorsRetryAfter(t *testing.T) {
+	var calls int32
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", r.URL.Query().Get("after"))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer serverMock.Close()
+
+	client, _, delays := newTestClient(Policy{MaxAttempts: 3, MaxDelay: 5 * time.Second})
+	resp, err := client.Get(serverMock.URL + "?after=2")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []time.Duration{2 * time.Second}, *delays)
+
+	// um Retry-After maior que MaxDelay não é esperado
+	atomic.StoreInt32(&calls, 0)
+	resp, err = client.Get(serverMock.URL + "?after=60")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestTransportRespectsDeadline(t *testing.T) {
+	var calls int32
+	serverMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer serverMock.Close()
+
+	client, _, delays := newTestClient(Policy{MaxAttempts: 3, MaxDelay: 5 * time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, serverMock.URL, nil)
+
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Empty(t, *delays)
+}
+
+func TestBackoffIsCapped(t *testing.T) {
+	p := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for n := 1; n < 100; n++ {
+		d := p.Backoff(n)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.LessOrEqual(t, d, time.Second)
+	}
+}
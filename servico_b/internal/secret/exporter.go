@@ -0,0 +1,80 @@
+package secret
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exporter redacts secrets from the names, attributes, events and status of
+// spans before handing them to the wrapped exporter. Upstream urls and the
+// errors that quote them end up in spans, so the api keys in them would
+// otherwise reach the collector.
+type Exporter struct {
+	sdktrace.SpanExporter
+	// Redact rewrites the strings of the spans, Redact by default. It may hide
+	// more than the secrets, as long as it hides them too.
+	Redact func(string) string
+}
+
+// NewExporter wraps exporter with redaction
+func NewExporter(exporter sdktrace.SpanExporter) *Exporter {
+	return &Exporter{SpanExporter: exporter, Redact: Redact}
+}
+
+func (e *Exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	redacted := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, span := range spans {
+		redacted[i] = redactedSpan{ReadOnlySpan: span, redact: e.Redact}
+	}
+	return e.SpanExporter.ExportSpans(ctx, redacted)
+}
+
+type redactedSpan struct {
+	sdktrace.ReadOnlySpan
+	redact func(string) string
+}
+
+func (s redactedSpan) Name() string {
+	return s.redact(s.ReadOnlySpan.Name())
+}
+
+func (s redactedSpan) Attributes() []attribute.KeyValue {
+	return redactAttributes(s.ReadOnlySpan.Attributes(), s.redact)
+}
+
+func (s redactedSpan) Events() []sdktrace.Event {
+	events := s.ReadOnlySpan.Events()
+	redacted := make([]sdktrace.Event, len(events))
+	for i, event := range events {
+		event.Name = s.redact(event.Name)
+		event.Attributes = redactAttributes(event.Attributes, s.redact)
+		redacted[i] = event
+	}
+	return redacted
+}
+
+func (s redactedSpan) Status() sdktrace.Status {
+	status := s.ReadOnlySpan.Status()
+	status.Description = s.redact(status.Description)
+	return status
+}
+
+func redactAttributes(attrs []attribute.KeyValue, redact func(string) string) []attribute.KeyValue {
+	redacted := make([]attribute.KeyValue, len(attrs))
+	for i, kv := range attrs {
+		switch kv.Value.Type() {
+		case attribute.STRING:
+			kv.Value = attribute.StringValue(redact(kv.Value.AsString()))
+		case attribute.STRINGSLICE:
+			values := kv.Value.AsStringSlice()
+			for j := range values {
+				values[j] = redact(values[j])
+			}
+			kv.Value = attribute.StringSliceValue(values)
+		}
+		redacted[i] = kv
+	}
+	return redacted
+}
@@ -0,0 +1,85 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultCooldown is how long a rejected key is left out of the rotation
+const DefaultCooldown = time.Hour
+
+// ErrNoKeys is returned when every key of a Keyring was rejected recently
+var ErrNoKeys = errors.New("secret: no usable key")
+
+// Keyring hands out api keys round-robin. A key the upstream refuses, because
+// it is invalid or its quota ran out, is left out for Cooldown, and the other
+// keys keep serving.
+type Keyring struct {
+	Name     string
+	Cooldown time.Duration
+
+	mu            sync.Mutex
+	keys          []string
+	rejectedUntil []time.Time
+	next          int
+	now           func() time.Time
+}
+
+// NewKeyring creates a Keyring over keys, registering them for redaction
+func NewKeyring(name string, keys []string, cooldown time.Duration) *Keyring {
+	if cooldown <= 0 {
+		cooldown = DefaultCooldown
+	}
+	Register(keys...)
+	return &Keyring{
+		Name:          name,
+		Cooldown:      cooldown,
+		keys:          keys,
+		rejectedUntil: make([]time.Time, len(keys)),
+		now:           time.Now,
+	}
+}
+
+// Len returns the number of keys, rejected or not
+func (k *Keyring) Len() int {
+	return len(k.keys)
+}
+
+// Key returns the next key not in cooldown
+func (k *Keyring) Key() (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.now()
+	for range k.keys {
+		i := k.next
+		k.next = (k.next + 1) % len(k.keys)
+		if !now.Before(k.rejectedUntil[i]) {
+			return k.keys[i], nil
+		}
+	}
+	return "", ErrNoKeys
+}
+
+// Reject leaves key out of the rotation for Cooldown
+func (k *Keyring) Reject(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for i, candidate := range k.keys {
+		if candidate == key {
+			k.rejectedUntil[i] = k.now().Add(k.Cooldown)
+		}
+	}
+}
+
+// ID names key without revealing it, as the keyring name and its position
+func (k *Keyring) ID(key string) string {
+	for i, candidate := range k.keys {
+		if candidate == key {
+			return fmt.Sprintf("%s#%d", k.Name, i+1)
+		}
+	}
+	return k.Name + "#?"
+}
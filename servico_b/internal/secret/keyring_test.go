@@ -0,0 +1,42 @@
+package secret
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyring(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	k := NewKeyring("weatherapi", []string{"a", "b", "c"}, time.Minute)
+	k.now = func() time.Time { return now }
+
+	next := func() string {
+		key, err := k.Key()
+		assert.NoError(t, err)
+		return key
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a"}, []string{next(), next(), next(), next()})
+	assert.Equal(t, "weatherapi#2", k.ID("b"))
+	assert.Equal(t, "weatherapi#?", k.ID("z"))
+
+	k.Reject("b")
+	assert.Equal(t, []string{"c", "a", "c"}, []string{next(), next(), next()})
+
+	k.Reject("a")
+	k.Reject("c")
+	_, err := k.Key()
+	assert.ErrorIs(t, err, ErrNoKeys)
+
+	// passado o cooldown as chaves voltam ao rodízio
+	now = now.Add(time.Minute)
+	assert.Equal(t, []string{"a", "b", "c"}, []string{next(), next(), next()})
+}
+
+func TestKeyringWithoutKeys(t *testing.T) {
+	k := NewKeyring("weatherapi", nil, 0)
+	assert.Equal(t, DefaultCooldown, k.Cooldown)
+	_, err := k.Key()
+	assert.ErrorIs(t, err, ErrNoKeys)
+}
@@ -0,0 +1,135 @@
+// Package secret loads credentials kept out of the configured urls and hides
+// them from logs and exported spans.
+package secret
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// Redacted replaces secrets in logs and spans
+	Redacted = "REDACTED"
+	// MinLength is the shortest secret Redact hides, as shorter ones would
+	// match unrelated text
+	MinLength = 8
+)
+
+// ErrTooShort is returned for a secret shorter than MinLength, which could not
+// be hidden from logs and spans
+var ErrTooShort = fmt.Errorf("secret: shorter than %d characters, it could not be redacted", MinLength)
+
+var (
+	mu      sync.RWMutex
+	secrets []string
+)
+
+// Load reads a list of secrets from file, one per line, or else from value,
+// separated by commas. Blank lines and lines starting with # are skipped. The
+// secrets found are registered for redaction, failing with ErrTooShort when
+// one of them is too short for it.
+func Load(file, value string) ([]string, error) {
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("secret: %w", err)
+		}
+		defer f.Close()
+
+		var values []string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			values = append(values, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("secret: reading %s: %w", file, err)
+		}
+		if err := Check(values...); err != nil {
+			return nil, fmt.Errorf("%w, in %s", err, file)
+		}
+		Register(values...)
+		return values, nil
+	}
+
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	if err := Check(values...); err != nil {
+		return nil, err
+	}
+	Register(values...)
+	return values, nil
+}
+
+// Check fails with ErrTooShort on the first of values Redact would not hide,
+// telling it by its position only
+func Check(values ...string) error {
+	for i, v := range values {
+		if len(v) < MinLength {
+			return fmt.Errorf("%w: secret #%d", ErrTooShort, i+1)
+		}
+	}
+	return nil
+}
+
+// Register adds values to the secrets hidden by Redact, both as they are and
+// escaped for a url query. Values shorter than MinLength are skipped, so
+// secrets about to be used are Checked first.
+func Register(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, v := range values {
+		if len(v) < MinLength {
+			continue
+		}
+		secrets = append(secrets, v)
+		if escaped := url.QueryEscape(v); escaped != v {
+			secrets = append(secrets, escaped)
+		}
+	}
+	// longer secrets first, so one containing another is hidden whole
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+}
+
+// Redact replaces every registered secret in s by Redacted
+func Redact(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, secret := range secrets {
+		if strings.Contains(s, secret) {
+			s = strings.ReplaceAll(s, secret, Redacted)
+		}
+	}
+	return s
+}
+
+// Writer redacts what is written to it before passing it on to w, meant for
+// the log output
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a Writer passing redacted output on to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (r *Writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
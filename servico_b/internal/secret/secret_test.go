@@ -0,0 +1,93 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys")
+	os.WriteFile(file, []byte("# chaves do weatherapi\nfile-key-1\n\n  file-key-2  \n"), 0o600)
+
+	keys, err := Load(file, "ignored")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"file-key-1", "file-key-2"}, keys)
+
+	keys, err = Load("", " env-key-1, ,env-key-2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"env-key-1", "env-key-2"}, keys)
+
+	keys, err = Load("", "")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing"), "")
+	assert.Error(t, err)
+
+	// uma chave curta demais não seria escondida, e é recusada sem aparecer no erro
+	_, err = Load("", "env-key-3,abc123")
+	assert.ErrorIs(t, err, ErrTooShort)
+	assert.NotContains(t, err.Error(), "abc123")
+	os.WriteFile(file, []byte("file-key-3\nabc123\n"), 0o600)
+	_, err = Load(file, "")
+	assert.ErrorIs(t, err, ErrTooShort)
+	assert.Equal(t, "env-key-3", Redact("env-key-3"))
+
+	// o que foi carregado passa a ser escondido
+	assert.Equal(t, "key="+Redacted+"&q=x", Redact("key=file-key-2&q=x"))
+	assert.Equal(t, "key="+Redacted, Redact("key=env-key-1"))
+}
+
+func TestRedact(t *testing.T) {
+	Register("s3cr3t+/=", "", "short")
+
+	assert.Equal(t, "nothing to hide", Redact("nothing to hide"))
+	assert.Equal(t, "short", Redact("short"))
+	assert.Equal(t, "a "+Redacted+" b "+Redacted, Redact("a s3cr3t+/= b s3cr3t%2B%2F%3D"))
+
+	var out bytes.Buffer
+	logger := log.New(NewWriter(&out), "", 0)
+	logger.Printf(`Get "https://api.weatherapi.com/v1/current.json?key=%s": timeout`, "s3cr3t%2B%2F%3D")
+	assert.Equal(t, `Get "https://api.weatherapi.com/v1/current.json?key=REDACTED": timeout`+"\n", out.String())
+}
+
+func TestExporter(t *testing.T) {
+	Register("span-secret")
+
+	recorder := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(NewExporter(recorder))).Tracer("test")
+
+	_, span := tracer.Start(context.Background(), "GET ?key=span-secret")
+	span.SetAttributes(
+		attribute.String("url.full", "https://host/?key=span-secret&q=x"),
+		attribute.StringSlice("urls", []string{"span-secret", "clean"}),
+		attribute.Int("http.response.status_code", 200),
+	)
+	err := errors.New(`Get "https://host/?key=span-secret": dial tcp: timeout`)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	span.End()
+
+	spans := recorder.GetSpans()
+	assert.Len(t, spans, 1)
+	s := spans[0]
+	assert.Equal(t, "GET ?key=REDACTED", s.Name)
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("url.full", "https://host/?key=REDACTED&q=x"),
+		attribute.StringSlice("urls", []string{"REDACTED", "clean"}),
+		attribute.Int("http.response.status_code", 200),
+	}, s.Attributes)
+	assert.Contains(t, s.Events[0].Attributes, attribute.String("exception.message", `Get "https://host/?key=REDACTED": dial tcp: timeout`))
+	assert.Equal(t, `Get "https://host/?key=REDACTED": dial tcp: timeout`, s.Status.Description)
+}
@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Domain attributes of the request spans, the ones traces are searched by
+const (
+	// CepKey is the CEP asked for, digits only, or its hash, see Cep
+	CepKey = attribute.Key("cep")
+	// LocalityKey and StateKey are where the CEP resolved to
+	LocalityKey = attribute.Key("address.localidade")
+	StateKey    = attribute.Key("address.uf")
+	// CepProviderKey and WeatherProviderKey name the providers that answered
+	CepProviderKey     = attribute.Key("cep.provider")
+	WeatherProviderKey = attribute.Key("weather.provider")
+	// CepCacheStatusKey and WeatherCacheStatusKey tell whether the answer came
+	// from the cache: hit, miss or stale
+	CepCacheStatusKey     = attribute.Key("cep.cache.status")
+	WeatherCacheStatusKey = attribute.Key("weather.cache.status")
+	// TempCKey, TempFKey and TempKKey are the temperatures answered
+	TempCKey = attribute.Key("weather.temp_c")
+	TempFKey = attribute.Key("weather.temp_f")
+	TempKKey = attribute.Key("weather.temp_k")
+)
+
+// ValidationFailedEvent is added to the request span when the request is refused
+const ValidationFailedEvent = "validation failed"
+
+// Cep is the CepKey attribute of cep, normalized to its digits. With a
+// hashKey the CEP is sent as the hex HMAC-SHA256 of the digits instead, so
+// traces of a CEP can still be found by hashing it with the same key. A plain
+// hash would not do, there are only 10^8 CEPs. See NewCepHasher for the CEPs
+// quoted elsewhere.
+func Cep(cep string, hashKey []byte) attribute.KeyValue {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, cep)
+	if len(hashKey) == 0 {
+		return CepKey.String(digits)
+	}
+	return CepKey.String(hashCep(digits, hashKey))
+}
+
+// NewCepHasher returns what replaces the CEPs quoted in a text by their hash
+// with hashKey, the value Cep gives them. The provider urls, the cache keys
+// and the errors quoting them carry the CEP too, so with a hashKey the exported
+// spans and logs go through it. A CEP is only told apart where it is known to
+// be one: written NNNNN-NNN, or as its 8 digits right after one of prefixes,
+// such as the cache key prefix and the part of the provider urls before the
+// CEP. Other numbers, ids and sizes among them, are left alone. Without a
+// hashKey the text is returned as is.
+func NewCepHasher(hashKey []byte, prefixes ...string) func(string) string {
+	if len(hashKey) == 0 {
+		return func(s string) string { return s }
+	}
+	alternatives := []string{`\b\d{5}-\d{3}\b`}
+	for _, prefix := range prefixes {
+		if prefix != "" {
+			alternatives = append(alternatives, regexp.QuoteMeta(prefix)+`\d{8}\b`)
+		}
+	}
+	pattern := regexp.MustCompile(strings.Join(alternatives, "|"))
+	return func(s string) string {
+		return pattern.ReplaceAllStringFunc(s, func(match string) string {
+			// the CEP ends the match, hyphenated or after its prefix
+			n := 8
+			if match[len(match)-4] == '-' {
+				n = 9
+			}
+			cep := match[len(match)-n:]
+			return match[:len(match)-n] + hashCep(strings.Replace(cep, "-", "", 1), hashKey)
+		})
+	}
+}
+
+// hashCep is the hex HMAC-SHA256 of the digits of a CEP with hashKey
+func hashCep(digits string, hashKey []byte) string {
+	mac := hmac.New(sha256.New, hashKey)
+	mac.Write([]byte(digits))
+	return hex.EncodeToString(mac.Sum(nil))
+}
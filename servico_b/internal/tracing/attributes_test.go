@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCep(t *testing.T) {
+	assert.Equal(t, CepKey.String("07096240"), Cep("07096-240", nil))
+
+	mac := hmac.New(sha256.New, []byte("chave"))
+	mac.Write([]byte("07096240"))
+	hashed := Cep("07096-240", []byte("chave"))
+	assert.Equal(t, CepKey, hashed.Key)
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), hashed.Value.AsString())
+
+	// o mesmo cep, com ou sem hífen, dá o mesmo hash
+	assert.Equal(t, hashed, Cep("07096240", []byte("chave")))
+	assert.NotEqual(t, hashed, Cep("07096240", []byte("outra")))
+}
+
+func TestCepHasher(t *testing.T) {
+	key := []byte("chave")
+	hashed := Cep("01001000", key).Value.AsString()
+	hashCeps := NewCepHasher(key, "cep:", "https://viacep.com.br/ws/", "https://cep.awesomeapi.com.br/json/")
+
+	for raw, expected := range map[string]string{
+		"https://viacep.com.br/ws/01001000/json/": "https://viacep.com.br/ws/" + hashed + "/json/",
+		"cep:01001000": "cep:" + hashed,
+		`Get "https://cep.awesomeapi.com.br/json/01001000": EOF`: `Get "https://cep.awesomeapi.com.br/json/` + hashed + `": EOF`,
+		"cep 01001-000 not found":                                "cep " + hashed + " not found",
+		// 8 dígitos fora dos lugares onde vai um cep não são ceps: ids, tamanhos, horários
+		"http.response.body.size=12345678":         "http.response.body.size=12345678",
+		"https://example.com/orders/01001000":      "https://example.com/orders/01001000",
+		"request 01001000 took 35ms":               "request 01001000 took 35ms",
+		"time=1719838800&latitude=-23.5475":        "time=1719838800&latitude=-23.5475",
+		"https://viacep.com.br/ws/010010001/json/": "https://viacep.com.br/ws/010010001/json/",
+	} {
+		assert.Equal(t, expected, hashCeps(raw), raw)
+	}
+	assert.Equal(t, "cep:01001000", NewCepHasher(nil, "cep:")("cep:01001000"))
+}
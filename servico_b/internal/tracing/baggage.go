@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Baggage keys servico A fills with the identity of the request
+const (
+	ClientIDKey = "client.id"
+	TenantKey   = "tenant.id"
+	ChannelKey  = "request.channel"
+)
+
+// BaggageProcessor copies members of the baggage in the context a span starts
+// with to attributes of the span, so the traces can be searched by who asked
+// for them. Only the keys it is given are copied, the baggage comes from the
+// caller and anything in it would otherwise reach the collector.
+type BaggageProcessor struct {
+	keys []string
+}
+
+var _ sdktrace.SpanProcessor = (*BaggageProcessor)(nil)
+
+// NewBaggageProcessor creates a BaggageProcessor copying the members of keys,
+// blank keys left out
+func NewBaggageProcessor(keys ...string) *BaggageProcessor {
+	p := &BaggageProcessor{}
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			p.keys = append(p.keys, key)
+		}
+	}
+	return p
+}
+
+func (p *BaggageProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	b := baggage.FromContext(parent)
+	for _, key := range p.keys {
+		if member := b.Member(key); member.Key() != "" {
+			s.SetAttributes(attribute.String(key, member.Value()))
+		}
+	}
+}
+
+func (p *BaggageProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+func (p *BaggageProcessor) Shutdown(context.Context) error { return nil }
+
+func (p *BaggageProcessor) ForceFlush(context.Context) error { return nil }
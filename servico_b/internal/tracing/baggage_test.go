@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestBaggageProcessor(t *testing.T) {
+	defer otel.SetTextMapPropagator(otel.GetTextMapPropagator())
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(NewBaggageProcessor(ClientIDKey, " "+TenantKey, ChannelKey, "")),
+		sdktrace.WithSpanProcessor(recorder),
+	).Tracer("test")
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Baggage", "client.id=acme,tenant.id=retail,request.channel=mobile,user.email=someone%40example.com")
+	ctx, span := StartServer(tracer, httptest.NewRecorder(), r, "request")
+	_, child := tracer.Start(ctx, "getCEP")
+	child.End()
+	span.End()
+	_, orphan := tracer.Start(context.Background(), "no baggage")
+	orphan.End()
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 3)
+	// o span da requisição e os seus filhos levam as chaves escolhidas, e só elas
+	for _, s := range spans[:2] {
+		assert.Contains(t, s.Attributes(), attribute.String(ClientIDKey, "acme"), s.Name())
+		assert.Contains(t, s.Attributes(), attribute.String(TenantKey, "retail"), s.Name())
+		assert.Contains(t, s.Attributes(), attribute.String(ChannelKey, "mobile"), s.Name())
+		for _, a := range s.Attributes() {
+			assert.NotEqual(t, attribute.Key("user.email"), a.Key, s.Name())
+		}
+	}
+	assert.Empty(t, spans[2].Attributes())
+}
@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	errMissing = errors.New("missing")
+	errBroken  = errors.New("broken")
+)
+
+func init() {
+	RegisterError(errMissing, "missing", true)
+	RegisterError(errBroken, "broken", false)
+}
+
+type statusError int
+
+func (e statusError) Error() string     { return fmt.Sprintf("status %d", int(e)) }
+func (e statusError) ErrorType() string { return fmt.Sprint(int(e)) }
+
+func TestErrorType(t *testing.T) {
+	for _, test := range []struct {
+		err       error
+		errorType string
+		expected  bool
+	}{
+		{fmt.Errorf("lookup: %w", errMissing), "missing", true},
+		{errBroken, "broken", false},
+		{fmt.Errorf("upstream: %w", statusError(502)), "502", false},
+		{fmt.Errorf("call: %w", context.DeadlineExceeded), "timeout", false},
+		{context.Canceled, "canceled", true},
+		{&http.MaxBytesError{}, "*http.MaxBytesError", false},
+		{errors.New("anything"), ErrorTypeOther, false},
+	} {
+		errorType, expected := ErrorType(test.err)
+		assert.Equal(t, test.errorType, errorType, test.err.Error())
+		assert.Equal(t, test.expected, expected, test.err.Error())
+	}
+}
+
+func TestEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	for _, err := range []error{nil, errMissing, errBroken} {
+		_, span := tracer.Start(context.Background(), "step")
+		End(span, err)
+	}
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 3)
+
+	// sucesso: nada gravado
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Empty(t, spans[0].Events())
+
+	// erro esperado: gravado sem marcar o span como falho
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+	assert.Contains(t, spans[1].Attributes(), attribute.String("error.type", "missing"))
+	assert.Len(t, spans[1].Events(), 1)
+	assert.Equal(t, "exception", spans[1].Events()[0].Name)
+	assert.Contains(t, spans[1].Events()[0].Attributes, attribute.String("error.type", "missing"))
+
+	assert.Equal(t, codes.Error, spans[2].Status().Code)
+	assert.Equal(t, "broken", spans[2].Status().Description)
+	assert.Contains(t, spans[2].Attributes(), attribute.String("error.type", "broken"))
+}
+
+func TestServerSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	for _, status := range []int{0, http.StatusNotFound, http.StatusBadGateway} {
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			_, span := StartServer(tracer, w, r, "request")
+			defer span.End()
+			w = span.Writer
+
+			if status != 0 {
+				w.WriteHeader(status)
+			}
+		}
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	}
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 3)
+	for _, span := range spans {
+		assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	}
+
+	assert.Contains(t, spans[0].Attributes(), attribute.Int("http.response.status_code", http.StatusOK))
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	// erros do cliente não são falhas do servidor
+	assert.Contains(t, spans[1].Attributes(), attribute.Int("http.response.status_code", http.StatusNotFound))
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+
+	assert.Contains(t, spans[2].Attributes(), attribute.Int("http.response.status_code", http.StatusBadGateway))
+	assert.Contains(t, spans[2].Attributes(), attribute.String("error.type", "502"))
+	assert.Equal(t, codes.Error, spans[2].Status().Code)
+}
@@ -0,0 +1,101 @@
+package web
+
+import (
+	"net/url"
+	"servico_b/internal/i18n"
+	"servico_b/internal/provider"
+	"strings"
+	"time"
+)
+
+// Extended fields of WeatherResponse, asked for with ?fields=humidity,wind or
+// all at once with ?detail=full. Clients asking for none keep the basic shape.
+const (
+	FieldHumidity    = "humidity"
+	FieldWind        = "wind"
+	FieldPressure    = "pressure"
+	FieldCondition   = "condition"
+	FieldFeelsLike   = "feelslike"
+	FieldUV          = "uv"
+	FieldLastUpdated = "last_updated"
+)
+
+var extendedFields = []string{
+	FieldHumidity, FieldWind, FieldPressure, FieldCondition, FieldFeelsLike, FieldUV, FieldLastUpdated,
+}
+
+// Fields is the set of extended fields a client asked for
+type Fields map[string]bool
+
+// ParseFields reads the extended fields asked for in query, none by default
+func ParseFields(query url.Values) (Fields, error) {
+	fields := Fields{}
+	switch detail := query.Get("detail"); detail {
+	case "", "basic":
+	case "full":
+		for _, f := range extendedFields {
+			fields[f] = true
+		}
+	default:
+		return nil, i18n.Errorf("invalid detail %q, expected basic or full", detail)
+	}
+
+	for _, list := range query["fields"] {
+		for _, f := range strings.Split(list, ",") {
+			f = strings.ToLower(strings.TrimSpace(f))
+			if f == "" {
+				continue
+			}
+			if !isExtendedField(f) {
+				return nil, i18n.Errorf("unknown field %q, expected some of %s", f, strings.Join(extendedFields, ","))
+			}
+			fields[f] = true
+		}
+	}
+	return fields, nil
+}
+
+func isExtendedField(f string) bool {
+	for _, known := range extendedFields {
+		if f == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ConditionResponse describes the sky, Icon is only sent by some providers
+type ConditionResponse struct {
+	Text string `json:"text"`
+	Icon string `json:"icon,omitempty"`
+}
+
+// addFields fills the extended fields of r asked for in fields from weather
+func (r *WeatherResponse) addFields(weather *provider.Weather, fields Fields) {
+	if fields[FieldHumidity] {
+		r.Humidity = &weather.Humidity
+	}
+	if fields[FieldWind] {
+		r.WindKph = &weather.WindKph
+		r.WindDegree = &weather.WindDegree
+		r.WindDir = weather.WindDir
+	}
+	if fields[FieldPressure] {
+		r.PressureMb = &weather.PressureMb
+	}
+	if fields[FieldCondition] {
+		r.Condition = &ConditionResponse{Text: weather.Condition, Icon: weather.ConditionIcon}
+	}
+	if fields[FieldFeelsLike] {
+		feelsLikeK := kelvin(weather.FeelsLikeC)
+		r.FeelsLike_c = &weather.FeelsLikeC
+		r.FeelsLike_f = &weather.FeelsLikeF
+		r.FeelsLike_k = &feelsLikeK
+	}
+	if fields[FieldUV] {
+		r.UV = &weather.UV
+	}
+	if fields[FieldLastUpdated] && !weather.LastUpdated.IsZero() {
+		r.LastUpdated = weather.LastUpdated.Format(time.RFC3339)
+	}
+}
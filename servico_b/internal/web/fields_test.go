@@ -0,0 +1,30 @@
+package web
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFields(t *testing.T) {
+	for query, expected := range map[string]Fields{
+		"":                           {},
+		"detail=basic":               {},
+		"fields=UV, humidity":        {FieldUV: true, FieldHumidity: true},
+		"fields=wind&fields=uv":      {FieldWind: true, FieldUV: true},
+		"detail=full&fields=uv":      {FieldHumidity: true, FieldWind: true, FieldPressure: true, FieldCondition: true, FieldFeelsLike: true, FieldUV: true, FieldLastUpdated: true},
+		"fields=last_updated,,wind,": {FieldLastUpdated: true, FieldWind: true},
+	} {
+		values, _ := url.ParseQuery(query)
+		fields, err := ParseFields(values)
+		assert.NoError(t, err, query)
+		assert.Equal(t, expected, fields, query)
+	}
+
+	for _, query := range []string{"detail=everything", "fields=humidity,temperature"} {
+		values, _ := url.ParseQuery(query)
+		_, err := ParseFields(values)
+		assert.Error(t, err, query)
+	}
+}
@@ -0,0 +1,108 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"servico_b/internal/i18n"
+	"servico_b/internal/problem"
+	"servico_b/internal/provider"
+	"servico_b/internal/tracing"
+)
+
+// MaxForecastDays is the longest forecast a client can ask for
+const MaxForecastDays = 14
+
+type ForecastRequest struct {
+	Cep  string `json:"cep"`
+	Days int    `json:"days"`
+}
+
+// DailyResponse is how forecast and history days are answered
+type DailyResponse struct {
+	Date      string  `json:"date"`
+	MinTemp_c float64 `json:"min_temp_C"`
+	MaxTemp_c float64 `json:"max_temp_C"`
+	MinTemp_f float64 `json:"min_temp_F"`
+	MaxTemp_f float64 `json:"max_temp_F"`
+	MinTemp_k float64 `json:"min_temp_K"`
+	MaxTemp_k float64 `json:"max_temp_K"`
+	Condition string  `json:"condition"`
+
+	// WeatherProvider is the provider of the day, set for history days, which
+	// fail over one by one
+	WeatherProvider string `json:"weather_provider,omitempty"`
+}
+
+type ForecastResponse struct {
+	City  string          `json:"city"`
+	State string          `json:"state,omitempty"`
+	Lat   float64         `json:"lat,omitempty"`
+	Lon   float64         `json:"lon,omitempty"`
+	Days  []DailyResponse `json:"days"`
+
+	CepProvider     string `json:"cep_provider,omitempty"`
+	WeatherProvider string `json:"weather_provider,omitempty"`
+}
+
+// HandleForecast answers the daily forecast of a CEP for the next days
+func (h *Webserver) HandleForecast(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServer(h.ServiceData.OTELTracer, w, r, "Previsao"+h.ServiceData.RequestNameOTEL)
+	defer span.End()
+	w = span.Writer
+
+	var request ForecastRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		h.rejectRequest(ctx, w, "cep", problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidZipcode, i18n.Sprintf(ctx, "invalid zipcode")))
+		return
+	}
+	if request.Days < 1 || request.Days > MaxForecastDays {
+		h.rejectRequest(ctx, w, "days", problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidDays,
+			i18n.Sprintf(ctx, "days must be between 1 and %d", MaxForecastDays)))
+		return
+	}
+
+	address, ok := h.lookupCep(ctx, w, request.Cep)
+	if !ok {
+		return
+	}
+
+	ctx, spanForecast := h.ServiceData.OTELTracer.Start(ctx, "getForecast")
+	forecast, err := h.ServiceData.WeatherProvider.Forecast(ctx, address, request.Days)
+	tracing.End(spanForecast, err)
+	if err != nil {
+		providerError(ctx, w, err, problem.New(http.StatusInternalServerError, problem.CodeWeatherLookupFailed,
+			i18n.Sprintf(ctx, "could not find the forecast for the zip code locality")))
+		return
+	}
+	span.SetAttributes(tracing.WeatherProviderKey.String(forecast.Provider))
+
+	response := ForecastResponse{
+		City:  address.Localidade,
+		State: address.UF,
+		Lat:   address.Latitude,
+		Lon:   address.Longitude,
+		Days:  make([]DailyResponse, 0, len(forecast.Days)),
+
+		CepProvider:     address.Provider,
+		WeatherProvider: forecast.Provider,
+	}
+	for _, day := range forecast.Days {
+		response.Days = append(response.Days, newDailyResponse(day))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func newDailyResponse(day provider.DailyWeather) DailyResponse {
+	return DailyResponse{
+		Date:      day.Date,
+		MinTemp_c: day.MinTempC,
+		MaxTemp_c: day.MaxTempC,
+		MinTemp_f: day.MinTempF,
+		MaxTemp_f: day.MaxTempF,
+		MinTemp_k: kelvin(day.MinTempC),
+		MaxTemp_k: kelvin(day.MaxTempC),
+		Condition: day.Condition,
+	}
+}
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"servico_b/internal/provider"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+)
+
+func newForecastRouter(cepURL, weatherURL string) http.Handler {
+	tracer := otel.Tracer("microservice-tracer-mock")
+
+	serviceData := &ServiceData{
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      tracer,
+		CepProvider: provider.NewCepChain(tracer, time.Second,
+			provider.NewViaCep(cepURL+"/ws/%s/json/", nil),
+		),
+		WeatherProvider: provider.NewWeatherChain(tracer, time.Second,
+			provider.NewWeatherAPI(weatherURL+"/v1/current.json?q=%s&aqi=no", nil),
+		),
+	}
+	return NewServer(serviceData).CreateServer()
+}
+
+func TestHandleForecast(t *testing.T) {
+	cepMock, weatherMock := newUpstreamMocks()
+	defer cepMock.Close()
+	defer weatherMock.Close()
+	router := newForecastRouter(cepMock.URL, weatherMock.URL)
+
+	reqBody, _ := json.Marshal(ForecastRequest{Cep: "07096240", Days: 2})
+	req, err := http.NewRequest("POST", "/forecast", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp ForecastResponse
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Guarulhos", resp.City)
+	assert.Equal(t, "weatherapi", resp.WeatherProvider)
+	assert.Equal(t, []DailyResponse{
+		{Date: "2024-07-01", MinTemp_c: 15.0, MaxTemp_c: 25.0, MinTemp_f: 59.0, MaxTemp_f: 77.0, MinTemp_k: 288.0, MaxTemp_k: 298.0, Condition: "Sunny"},
+		{Date: "2024-07-02", MinTemp_c: 12.0, MaxTemp_c: 20.0, MinTemp_f: 53.6, MaxTemp_f: 68.0, MinTemp_k: 285.0, MaxTemp_k: 293.0, Condition: "Light rain"},
+	}, resp.Days)
+}
+
+func TestHandleForecastInvalidDays(t *testing.T) {
+	cepMock, weatherMock := newUpstreamMocks()
+	defer cepMock.Close()
+	defer weatherMock.Close()
+	router := newForecastRouter(cepMock.URL, weatherMock.URL)
+
+	for _, days := range []int{0, -1, MaxForecastDays + 1} {
+		reqBody, _ := json.Marshal(ForecastRequest{Cep: "07096240", Days: days})
+		req, _ := http.NewRequest("POST", "/forecast", bytes.NewBuffer(reqBody))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, days)
+	}
+}
+
+func TestHandleForecastZipCodeNotFound(t *testing.T) {
+	cepMock, weatherMock := newUpstreamMocks()
+	defer cepMock.Close()
+	defer weatherMock.Close()
+	router := newForecastRouter(cepMock.URL, weatherMock.URL)
+
+	reqBody, _ := json.Marshal(ForecastRequest{Cep: "00000000", Days: 3})
+	req, _ := http.NewRequest("POST", "/forecast", bytes.NewBuffer(reqBody))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,166 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"servico_b/internal/i18n"
+	"servico_b/internal/problem"
+	"servico_b/internal/provider"
+	"servico_b/internal/tracing"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// MaxHistoryDays is the longest date range a client can ask for
+	MaxHistoryDays = 31
+
+	// historyConcurrency bounds how many days are fetched at once
+	historyConcurrency = 4
+)
+
+type HistoryRequest struct {
+	Cep   string `json:"cep"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type HistoryResponse struct {
+	City  string          `json:"city"`
+	State string          `json:"state,omitempty"`
+	Lat   float64         `json:"lat,omitempty"`
+	Lon   float64         `json:"lon,omitempty"`
+	Days  []DailyResponse `json:"days"`
+
+	CepProvider     string `json:"cep_provider,omitempty"`
+	WeatherProvider string `json:"weather_provider,omitempty"`
+}
+
+// ParseDateRange validates an inclusive range of past days, at most MaxHistoryDays long
+func ParseDateRange(start, end string, today time.Time) (time.Time, time.Time, error) {
+	from, err := time.Parse(provider.DateLayout, start)
+	if err != nil {
+		return time.Time{}, time.Time{}, i18n.Errorf("invalid start date")
+	}
+	to, err := time.Parse(provider.DateLayout, end)
+	if err != nil {
+		return time.Time{}, time.Time{}, i18n.Errorf("invalid end date")
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, i18n.Errorf("end date before start date")
+	}
+	if to.Format(provider.DateLayout) > today.Format(provider.DateLayout) {
+		return time.Time{}, time.Time{}, i18n.Errorf("dates must not be in the future")
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > MaxHistoryDays {
+		return time.Time{}, time.Time{}, i18n.Errorf("date range too long")
+	}
+	return from, to, nil
+}
+
+// HandleHistory answers the weather observed for a CEP over a range of past days
+func (h *Webserver) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServer(h.ServiceData.OTELTracer, w, r, "Historico"+h.ServiceData.RequestNameOTEL)
+	defer span.End()
+	w = span.Writer
+
+	var request HistoryRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		h.rejectRequest(ctx, w, "cep", problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidZipcode, i18n.Sprintf(ctx, "invalid zipcode")))
+		return
+	}
+	start, end, err := ParseDateRange(request.Start, request.End, time.Now())
+	if err != nil {
+		h.rejectRequest(ctx, w, "date_range", problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidDateRange, i18n.Message(ctx, err)))
+		return
+	}
+
+	address, ok := h.lookupCep(ctx, w, request.Cep)
+	if !ok {
+		return
+	}
+
+	history, err := h.fetchHistory(ctx, address, start, end)
+	if err != nil {
+		providerError(ctx, w, err, problem.New(http.StatusInternalServerError, problem.CodeWeatherLookupFailed,
+			i18n.Sprintf(ctx, "could not find the weather history for the zip code locality")))
+		return
+	}
+	providers := historyProviders(history)
+	span.SetAttributes(tracing.WeatherProviderKey.String(providers))
+
+	response := HistoryResponse{
+		City:  address.Localidade,
+		State: address.UF,
+		Lat:   address.Latitude,
+		Lon:   address.Longitude,
+		Days:  make([]DailyResponse, 0, len(history)),
+
+		CepProvider:     address.Provider,
+		WeatherProvider: providers,
+	}
+	for _, day := range history {
+		daily := newDailyResponse(day.Day)
+		daily.WeatherProvider = day.Provider
+		response.Days = append(response.Days, daily)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// fetchHistory gets every day between start and end, each under its own span,
+// keeping the days in order
+func (h *Webserver) fetchHistory(ctx context.Context, address *provider.Address, start, end time.Time) ([]*provider.History, error) {
+	days := int(end.Sub(start).Hours()/24) + 1
+	history := make([]*provider.History, days)
+	errs := make([]error, days)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, historyConcurrency)
+	for i := 0; i < days; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			date := start.AddDate(0, 0, i)
+			ctx, spanDay := h.ServiceData.OTELTracer.Start(ctx, "getHistory", trace.WithAttributes(
+				attribute.String("history.date", date.Format(provider.DateLayout)),
+			))
+			defer func() { tracing.End(spanDay, errs[i]) }()
+
+			history[i], errs[i] = h.ServiceData.WeatherProvider.History(ctx, address, date)
+			if errs[i] == nil {
+				spanDay.SetAttributes(tracing.WeatherProviderKey.String(history[i].Provider))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// historyProviders lists the providers that answered the days of history,
+// comma separated in the order they were first used. Each day fails over on
+// its own, so a range may be served by more than one.
+func historyProviders(history []*provider.History) string {
+	var providers []string
+	for _, day := range history {
+		if !slices.Contains(providers, day.Provider) {
+			providers = append(providers, day.Provider)
+		}
+	}
+	return strings.Join(providers, ",")
+}
@@ -0,0 +1,187 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"servico_b/internal/provider"
+	"servico_b/internal/tracing"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestParseDateRange(t *testing.T) {
+	today := time.Date(2024, 7, 10, 15, 0, 0, 0, time.UTC)
+
+	start, end, err := ParseDateRange("2024-07-01", "2024-07-10", today)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2024, 7, 10, 0, 0, 0, 0, time.UTC), end)
+
+	_, _, err = ParseDateRange("2024-06-10", "2024-07-10", today)
+	assert.NoError(t, err)
+
+	for _, dates := range [][2]string{
+		{"01/07/2024", "2024-07-02"},
+		{"2024-07-01", ""},
+		{"2024-07-05", "2024-07-01"},
+		{"2024-07-01", "2024-07-11"},
+		{"2024-06-09", "2024-07-10"},
+	} {
+		_, _, err := ParseDateRange(dates[0], dates[1], today)
+		assert.Error(t, err, dates)
+	}
+}
+
+func TestHandleHistory(t *testing.T) {
+	cepMock, weatherMock := newUpstreamMocks()
+	defer cepMock.Close()
+	defer weatherMock.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	serviceData := &ServiceData{
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      tracer,
+		CepProvider: provider.NewCepChain(tracer, time.Second,
+			provider.NewViaCep(cepMock.URL+"/ws/%s/json/", nil),
+		),
+		WeatherProvider: provider.NewWeatherChain(tracer, time.Second,
+			provider.NewWeatherAPI(weatherMock.URL+"/v1/current.json?q=%s&aqi=no", nil),
+		),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	reqBody, _ := json.Marshal(HistoryRequest{Cep: "07096240", Start: "2024-07-01", End: "2024-07-03"})
+	req, err := http.NewRequest("POST", "/history", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp HistoryResponse
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Guarulhos", resp.City)
+	assert.Equal(t, "weatherapi", resp.WeatherProvider)
+	assert.Len(t, resp.Days, 3)
+	for i, day := range resp.Days {
+		assert.Equal(t, time.Date(2024, 7, 1+i, 0, 0, 0, 0, time.UTC).Format(provider.DateLayout), day.Date)
+		assert.Equal(t, 30.0, day.MaxTemp_c)
+		assert.Equal(t, 293.0, day.MinTemp_k)
+	}
+
+	var dates []string
+	for _, span := range recorder.Ended() {
+		if span.Name() != "getHistory" {
+			continue
+		}
+		for _, kv := range span.Attributes() {
+			if kv.Key == "history.date" {
+				dates = append(dates, kv.Value.AsString())
+			}
+		}
+	}
+	assert.ElementsMatch(t, []string{"2024-07-01", "2024-07-02", "2024-07-03"}, dates)
+}
+
+func TestHandleHistoryMixedProviders(t *testing.T) {
+	cepMock, _ := newUpstreamMocks()
+	defer cepMock.Close()
+	weatherMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search":
+			w.Write([]byte(`{"results": [{"name": "Guarulhos", "latitude": -23.46278, "longitude": -46.53333, "admin1": "São Paulo"}]}`))
+		case "/archive":
+			// o último dia ainda não chegou ao arquivo do Open-Meteo
+			if date := r.URL.Query().Get("start_date"); date == "2024-07-03" {
+				w.Write([]byte(`{"daily": {"time": ["2024-07-03"], "temperature_2m_max": [null], "temperature_2m_min": [null], "weather_code": [null]}}`))
+				return
+			}
+			fmt.Fprintf(w, `{"daily": {"time": [%q], "temperature_2m_max": [28.0], "temperature_2m_min": [18.0], "weather_code": [0]}}`,
+				r.URL.Query().Get("start_date"))
+		case "/v1/history.json":
+			fmt.Fprintf(w, `{"forecast": {"forecastday": [
+				{"date": %q, "day": {"maxtemp_c": 30.0, "mintemp_c": 20.0, "condition": {"text": "Sunny"}}}
+			]}}`, r.URL.Query().Get("dt"))
+		}
+	}))
+	defer weatherMock.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	openMeteo := provider.NewOpenMeteo(weatherMock.URL+"/forecast", weatherMock.URL+"/search", nil)
+	openMeteo.ArchiveURL = weatherMock.URL + "/archive"
+	serviceData := &ServiceData{
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      tracer,
+		CepProvider: provider.NewCepChain(tracer, time.Second,
+			provider.NewViaCep(cepMock.URL+"/ws/%s/json/", nil),
+		),
+		WeatherProvider: provider.NewWeatherChain(tracer, time.Second,
+			openMeteo,
+			provider.NewWeatherAPI(weatherMock.URL+"/v1/current.json?q=%s&aqi=no", nil),
+		),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	reqBody, _ := json.Marshal(HistoryRequest{Cep: "07096240", Start: "2024-07-01", End: "2024-07-03"})
+	req, _ := http.NewRequest("POST", "/history", bytes.NewBuffer(reqBody))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp HistoryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	// cada dia diz quem o atendeu, e o intervalo lista os dois provedores
+	assert.Equal(t, "openmeteo,weatherapi", resp.WeatherProvider)
+	var providers []string
+	for _, day := range resp.Days {
+		providers = append(providers, day.WeatherProvider)
+	}
+	assert.Equal(t, []string{"openmeteo", "openmeteo", "weatherapi"}, providers)
+	assert.Equal(t, 30.0, resp.Days[2].MaxTemp_c)
+
+	spanProviders := map[string]string{}
+	for _, span := range recorder.Ended() {
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, kv := range span.Attributes() {
+			attrs[kv.Key] = kv.Value
+		}
+		switch span.Name() {
+		case "getHistory":
+			spanProviders[attrs["history.date"].AsString()] = attrs[tracing.WeatherProviderKey].AsString()
+		case "Historico" + serviceData.RequestNameOTEL:
+			assert.Equal(t, "openmeteo,weatherapi", attrs[tracing.WeatherProviderKey].AsString())
+		}
+	}
+	assert.Equal(t, map[string]string{"2024-07-01": "openmeteo", "2024-07-02": "openmeteo", "2024-07-03": "weatherapi"}, spanProviders)
+}
+
+func TestHandleHistoryInvalidRange(t *testing.T) {
+	cepMock, weatherMock := newUpstreamMocks()
+	defer cepMock.Close()
+	defer weatherMock.Close()
+	router := newForecastRouter(cepMock.URL, weatherMock.URL)
+
+	reqBody, _ := json.Marshal(HistoryRequest{Cep: "07096240", Start: "2024-01-01", End: "2024-03-01"})
+	req, _ := http.NewRequest("POST", "/history", bytes.NewBuffer(reqBody))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
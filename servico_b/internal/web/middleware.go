@@ -0,0 +1,88 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"servico_b/internal/i18n"
+	"servico_b/internal/problem"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+// routeMethods are the methods methodNotAllowed looks for in the Allow header
+var routeMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+
+// notFound answers requests to paths with no route
+func notFound(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	problem.Write(ctx, w, problem.New(http.StatusNotFound, problem.CodeRouteNotFound, i18n.Sprintf(ctx, "route not found")))
+}
+
+// methodNotAllowed answers requests to paths of router with a method they do
+// not take, listing the ones they do in the Allow header
+func methodNotAllowed(router chi.Routes) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		var allowed []string
+		for _, method := range routeMethods {
+			if router.Match(chi.NewRouteContext(), method, r.URL.Path) {
+				allowed = append(allowed, method)
+			}
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		problem.Write(ctx, w, problem.New(http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed,
+			i18n.Sprintf(ctx, "method %s not allowed", r.Method)))
+	}
+}
+
+// recoverer is middleware.Recoverer answering with a problem: it logs the
+// panic of a handler with its stack and answers 500, unless the response had
+// already started
+func recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+			ctx := r.Context()
+			slog.ErrorContext(ctx, "handler panicked",
+				"panic", rvr,
+				"stack", string(debug.Stack()),
+				"request_id", middleware.GetReqID(ctx),
+			)
+			if ww.Status() == 0 {
+				problem.Write(ctx, ww, problem.New(http.StatusInternalServerError, problem.CodeInternal, i18n.Sprintf(ctx, "internal error")))
+			}
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// timeout is middleware.Timeout answering with a problem: the context of the
+// request is done after d, and a handler that returns past it without having
+// answered gets a 504
+func timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			if ww.Status() == 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				problem.Write(ctx, ww, problem.New(http.StatusGatewayTimeout, problem.CodeTimeout, i18n.Sprintf(ctx, "request timed out")))
+			}
+		})
+	}
+}
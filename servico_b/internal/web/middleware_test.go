@@ -0,0 +1,84 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"servico_b/internal/problem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// decodeProblem reads the problem document answered in rec
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) problem.Problem {
+	assert.Equal(t, problem.ContentType, rec.Header().Get("Content-Type"))
+	var p problem.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestRouterProblems(t *testing.T) {
+	router := NewServer(&ServiceData{OTELTracer: sdktrace.NewTracerProvider().Tracer("test")}).CreateServer()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/weather", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, problem.CodeRouteNotFound, decodeProblem(t, rec).Code)
+
+	rec = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/forecast", nil)
+	r.Header.Set("Accept-Language", "pt-BR")
+	router.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+	p := decodeProblem(t, rec)
+	assert.Equal(t, problem.CodeMethodNotAllowed, p.Code)
+	assert.Equal(t, "método GET não permitido", p.Detail)
+}
+
+func TestRecoverer(t *testing.T) {
+	rec := httptest.NewRecorder()
+	recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, problem.CodeInternal, decodeProblem(t, rec).Code)
+
+	// com a resposta já começada, não há como trocar o status
+	rec = httptest.NewRecorder()
+	recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{"))
+		panic("boom")
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "{", rec.Body.String())
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	rec := httptest.NewRecorder()
+	timeout(10*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Equal(t, problem.CodeTimeout, decodeProblem(t, rec).Code)
+
+	// a resposta do handler, mesmo depois do prazo, é mantida
+	rec = httptest.NewRecorder()
+	timeout(10*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		problem.Write(r.Context(), w, problem.New(http.StatusServiceUnavailable, "unavailable", ""))
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "unavailable", decodeProblem(t, rec).Code)
+}
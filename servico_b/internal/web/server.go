@@ -1,18 +1,22 @@
 package web
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"io"
-	"io/ioutil"
+	"errors"
 	"net/http"
-	"net/url"
+	"servico_b/internal/breaker"
+	"servico_b/internal/i18n"
+	"servico_b/internal/logging"
+	"servico_b/internal/metrics"
+	"servico_b/internal/problem"
+	"servico_b/internal/provider"
+	"servico_b/internal/tracing"
 	"time"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -20,24 +24,30 @@ type Webserver struct {
 	ServiceData *ServiceData
 }
 
-type ViaCepResponse struct {
-	Localidade string `json:localidade`
-}
-
-type WeatherReport struct {
-	Current WeatherResponse `json:current`
-}
-
-type Current struct {
-	Temp_c float64 `json:temp_c`
-	Temp_f float64 `json:temp_f`
-}
-
 type WeatherResponse struct {
 	City   string  `json:"city"`
-	Temp_c float64 `json:temp_C`
-	Temp_f float64 `json:temp_F`
-	Temp_k float64 `json:temp_K`
+	State  string  `json:"state,omitempty"`
+	Lat    float64 `json:"lat,omitempty"`
+	Lon    float64 `json:"lon,omitempty"`
+	Temp_c float64 `json:"temp_C"`
+	Temp_f float64 `json:"temp_F"`
+	Temp_k float64 `json:"temp_K"`
+
+	CepProvider     string `json:"cep_provider,omitempty"`
+	WeatherProvider string `json:"weather_provider,omitempty"`
+
+	// extended fields, only sent when asked for, see ParseFields
+	Humidity    *float64           `json:"humidity,omitempty"`
+	WindKph     *float64           `json:"wind_kph,omitempty"`
+	WindDegree  *int               `json:"wind_degree,omitempty"`
+	WindDir     string             `json:"wind_dir,omitempty"`
+	PressureMb  *float64           `json:"pressure_mb,omitempty"`
+	Condition   *ConditionResponse `json:"condition,omitempty"`
+	FeelsLike_c *float64           `json:"feelslike_C,omitempty"`
+	FeelsLike_f *float64           `json:"feelslike_F,omitempty"`
+	FeelsLike_k *float64           `json:"feelslike_K,omitempty"`
+	UV          *float64           `json:"uv,omitempty"`
+	LastUpdated string             `json:"last_updated,omitempty"`
 }
 
 // NewServer creates a new server instance
@@ -50,114 +60,205 @@ func NewServer(serviceData *ServiceData) *Webserver {
 // createServer creates a new server instance with go chi router
 func (we *Webserver) CreateServer() *chi.Mux {
 	router := chi.NewRouter()
+	router.NotFound(notFound)
+	router.MethodNotAllowed(methodNotAllowed(router))
 
 	router.Use(middleware.RequestID)
 	router.Use(middleware.RealIP)
-	router.Use(middleware.Recoverer)
-	router.Use(middleware.Logger)
-	router.Use(middleware.Timeout(60 * time.Second))
+	router.Use(we.ServiceData.Metrics.Middleware)
+	router.Use(i18n.Middleware)
+	router.Use(recoverer)
+	router.Use(logging.Middleware)
+	router.Use(timeout(60 * time.Second))
 	router.Post("/", we.HandleRequest)
+	router.Post("/forecast", we.HandleForecast)
+	router.Post("/history", we.HandleHistory)
+	if we.ServiceData.MetricsHandler != nil {
+		router.Handle("/metrics", we.ServiceData.MetricsHandler)
+	}
 	return router
 }
 
 type ServiceData struct {
 	Title              string
 	ExternalCallMethod string
-	CepURL             string
-	WeatherURL         string
+	CepProvider        provider.CepProvider
+	WeatherProvider    provider.WeatherProvider
 	RequestNameOTEL    string
 	OTELTracer         trace.Tracer
+	// CepHashKey, when set, hashes the CEP in the span attributes, see tracing.Cep
+	CepHashKey []byte
+	// Metrics gets the request, cache and CEP lookup measurements, nothing is
+	// recorded when nil
+	Metrics *metrics.Metrics
+	// MetricsHandler serves /metrics on the router, left nil when the metrics
+	// are off or served on the admin port
+	MetricsHandler http.Handler
 }
 
 func (h *Webserver) HandleRequest(w http.ResponseWriter, r *http.Request) {
-	carrier := propagation.HeaderCarrier(r.Header)
-	ctx := r.Context()
-	ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
-
-	ctx, span := h.ServiceData.OTELTracer.Start(ctx, "Chamada externa"+h.ServiceData.RequestNameOTEL)
+	ctx, span := tracing.StartServer(h.ServiceData.OTELTracer, w, r, "Chamada externa"+h.ServiceData.RequestNameOTEL)
 	defer span.End()
+	w = span.Writer
 
 	var request map[string]string
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		http.Error(w, "invalid zipcode", http.StatusUnprocessableEntity)
+		h.rejectRequest(ctx, w, "cep", problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidZipcode, i18n.Sprintf(ctx, "invalid zipcode")))
 		return
 	}
 	cep := request["cep"]
-
-	ctx, spanCep := h.ServiceData.OTELTracer.Start(ctx, "getCEP")
-
-	// Buscar cep na api da viacep
-	var req *http.Request
-	endpoint := fmt.Sprintf(h.ServiceData.CepURL, cep)
-	req, err = http.NewRequestWithContext(ctx, h.ServiceData.ExternalCallMethod, endpoint, nil)
-	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
-	resp, err := http.DefaultClient.Do(req)
+	fields, err := ParseFields(r.URL.Query())
 	if err != nil {
-		http.Error(w, "can not find zip code", http.StatusNotFound)
+		h.rejectRequest(ctx, w, "fields", problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidFields, i18n.Message(ctx, err)))
 		return
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	address, ok := h.lookupCep(ctx, w, cep)
+	if !ok {
 		return
 	}
-	var c ViaCepResponse
-	err = json.Unmarshal(body, &c)
+
+	ctx, spanWeather := h.ServiceData.OTELTracer.Start(ctx, "getWeather")
+	weather, err := h.ServiceData.WeatherProvider.CurrentWeather(ctx, address)
+	tracing.End(spanWeather, err)
 	if err != nil {
-		http.Error(w, `{"message": "Erro interno"}`, http.StatusInternalServerError)
+		providerError(ctx, w, err, problem.New(http.StatusInternalServerError, problem.CodeWeatherLookupFailed,
+			i18n.Sprintf(ctx, "could not find the current weather for the zip code locality")))
 		return
 	}
 
-	if c.Localidade == "" {
-		http.Error(w, `{"message": "can not find zip code"}`, http.StatusNotFound)
-		return
+	tempC := weather.TempC
+	tempF := weather.TempF
+	tempK := kelvin(weather.TempC)
+	span.SetAttributes(
+		tracing.WeatherProviderKey.String(weather.Provider),
+		tracing.TempCKey.Float64(tempC),
+		tracing.TempFKey.Float64(tempF),
+		tracing.TempKKey.Float64(tempK),
+	)
+	if weather.CacheStatus != "" {
+		span.SetAttributes(tracing.WeatherCacheStatusKey.String(weather.CacheStatus))
 	}
+	h.ServiceData.Metrics.RecordCache(ctx, "weather", weather.CacheStatus)
 
-	spanCep.End()
-
-	location := url.QueryEscape(c.Localidade)
+	response := WeatherResponse{
+		City:   address.Localidade,
+		State:  address.UF,
+		Lat:    address.Latitude,
+		Lon:    address.Longitude,
+		Temp_c: tempC,
+		Temp_f: tempF,
+		Temp_k: tempK,
 
-	ctx, spanWeather := h.ServiceData.OTELTracer.Start(ctx, "getWeather")
+		CepProvider:     address.Provider,
+		WeatherProvider: weather.Provider,
+	}
+	response.addFields(weather, fields)
+	// avisa o cliente quando o clima veio de uma entrada vencida do cache
+	if weather.Stale {
+		w.Header().Add("Warning", `110 - "Response is Stale"`)
+	}
+	if weather.RevalidationFailed {
+		w.Header().Add("Warning", `111 - "Revalidation Failed"`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
 
-	// buscar o clima da localidade
-	res, err := http.Get(fmt.Sprintf(h.ServiceData.WeatherURL, location))
+// lookupCep resolves cep under its own span, writing the error response when it
+// fails. The CEP and the address it resolved to are set on the request span.
+func (h *Webserver) lookupCep(ctx context.Context, w http.ResponseWriter, cep string) (*provider.Address, bool) {
+	cep, err := provider.ParseCep(cep)
 	if err != nil {
-		http.Error(w, `{"message": "Erro ao achar o tempo atual para a localidade informada"}`, http.StatusInternalServerError)
-		return
+		h.rejectRequest(ctx, w, "cep", problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidZipcode, i18n.Sprintf(ctx, "invalid zipcode")))
+		return nil, false
 	}
-	defer res.Body.Close()
-
-	body, err = io.ReadAll(res.Body)
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(tracing.Cep(cep, h.ServiceData.CepHashKey))
 
+	ctx, spanCep := h.ServiceData.OTELTracer.Start(ctx, "getCEP")
+	address, err := h.ServiceData.CepProvider.LookupCep(ctx, cep)
+	tracing.End(spanCep, err)
+	if errors.Is(err, provider.ErrCepNotFound) {
+		h.ServiceData.Metrics.RecordCepLookup(ctx, metrics.CepNotFound)
+		problem.Write(ctx, w, problem.New(http.StatusNotFound, problem.CodeZipcodeNotFound, i18n.Sprintf(ctx, "can not find zip code")))
+		return nil, false
+	}
 	if err != nil {
-		http.Error(w, `{"message": "Erro ao achar o tempo atual para a localidade informada"}`, http.StatusInternalServerError)
-		return
+		h.ServiceData.Metrics.RecordCepLookup(ctx, metrics.CepError)
+		providerError(ctx, w, err, problem.New(http.StatusInternalServerError, problem.CodeInternal, i18n.Sprintf(ctx, "internal error")))
+		return nil, false
 	}
+	h.ServiceData.Metrics.RecordCepLookup(ctx, metrics.CepFound)
+	h.ServiceData.Metrics.RecordCache(ctx, "cep", address.CacheStatus)
 
-	var t WeatherReport
-	err = json.Unmarshal(body, &t)
-	if err != nil {
-		http.Error(w, `{"message": "Erro ao achar o tempo atual para a localidade informada"}`, http.StatusInternalServerError)
-		fmt.Println(err)
-		return
+	span.SetAttributes(
+		tracing.LocalityKey.String(address.Localidade),
+		tracing.StateKey.String(address.UF),
+		tracing.CepProviderKey.String(address.Provider),
+	)
+	if address.CacheStatus != "" {
+		span.SetAttributes(tracing.CepCacheStatusKey.String(address.CacheStatus))
 	}
+	return address, true
+}
 
-	spanWeather.End()
+// rejectRequest answers p to a request that failed validation, recording on
+// the request span which field was refused
+func (h *Webserver) rejectRequest(ctx context.Context, w http.ResponseWriter, field string, p *problem.Problem) {
+	if field == "cep" {
+		h.ServiceData.Metrics.RecordCepLookup(ctx, metrics.CepInvalid)
+	}
+	trace.SpanFromContext(ctx).AddEvent(tracing.ValidationFailedEvent, trace.WithAttributes(
+		attribute.String("validation.field", field),
+		attribute.String("problem.code", p.Code),
+	))
+	problem.Write(ctx, w, p)
+}
 
-	tempC := t.Current.Temp_c
-	tempF := t.Current.Temp_f
-	tempK := t.Current.Temp_c + 273.0
+// providerError answers a failed provider call with fallback, or with 503 when
+// every provider failed fast because its circuit breaker is open, or 429 when
+// their rate limits held all of them back. One provider failing fast is not
+// enough: the others may have failed for a reason of their own.
+func providerError(ctx context.Context, w http.ResponseWriter, err error, fallback *problem.Problem) {
+	errs := attemptErrors(err)
+	var open, limited int
+	for _, err := range errs {
+		switch {
+		case errors.Is(err, provider.ErrRateLimited):
+			limited++
+		case errors.Is(err, breaker.ErrOpen):
+			open++
+		}
+	}
+	switch {
+	case limited == len(errs):
+		problem.Write(ctx, w, problem.New(http.StatusTooManyRequests, problem.CodeRateLimited,
+			i18n.Sprintf(ctx, "upstream rate limit reached, try again later")))
+	case open+limited == len(errs):
+		problem.Write(ctx, w, problem.New(http.StatusServiceUnavailable, problem.CodeUpstreamUnavailable,
+			i18n.Sprintf(ctx, "upstream providers unavailable, try again later")))
+	default:
+		problem.Write(ctx, w, fallback)
+	}
+}
 
-	response := WeatherResponse{
-		City:   c.Localidade,
-		Temp_c: tempC,
-		Temp_f: tempF,
-		Temp_k: tempK,
+// attemptErrors splits the error of a chain into the errors of its provider
+// attempts, which the chains join
+func attemptErrors(err error) []error {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if joined, ok := e.(interface{ Unwrap() []error }); ok {
+			var errs []error
+			for _, each := range joined.Unwrap() {
+				errs = append(errs, attemptErrors(each)...)
+			}
+			return errs
+		}
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	return []error{err}
+}
 
+func kelvin(celsius float64) float64 {
+	return celsius + 273.0
 }
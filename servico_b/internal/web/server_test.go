@@ -2,24 +2,80 @@ package web
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"servico_b/internal/breaker"
+	"servico_b/internal/cache"
+	"servico_b/internal/metrics"
+	"servico_b/internal/problem"
+	"servico_b/internal/provider"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// newUpstreamMocks starts fake viacep and weatherapi servers
+func newUpstreamMocks() (*httptest.Server, *httptest.Server) {
+	cepMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ws/07096240/json/" {
+			w.Write([]byte(`{"cep": "07096-240", "localidade": "Guarulhos", "uf": "SP"}`))
+			return
+		}
+		w.Write([]byte(`{"erro": true}`))
+	}))
+	weatherMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/forecast.json" {
+			w.Write([]byte(`{"forecast": {"forecastday": [
+				{"date": "2024-07-01", "day": {"maxtemp_c": 25.0, "maxtemp_f": 77.0, "mintemp_c": 15.0, "mintemp_f": 59.0, "condition": {"text": "Sunny"}}},
+				{"date": "2024-07-02", "day": {"maxtemp_c": 20.0, "maxtemp_f": 68.0, "mintemp_c": 12.0, "mintemp_f": 53.6, "condition": {"text": "Light rain"}}}
+			]}}`))
+			return
+		}
+		if r.URL.Path == "/v1/history.json" {
+			fmt.Fprintf(w, `{"forecast": {"forecastday": [
+				{"date": "%s", "day": {"maxtemp_c": 30.0, "maxtemp_f": 86.0, "mintemp_c": 20.0, "mintemp_f": 68.0, "condition": {"text": "Sunny"}}}
+			]}}`, r.URL.Query().Get("dt"))
+			return
+		}
+		condition := "Sunny"
+		if r.URL.Query().Get("lang") == "pt" {
+			condition = "Sol"
+		}
+		fmt.Fprintf(w, `{"current": {"temp_c": 25.0, "temp_f": 77.0, "humidity": 60, "wind_kph": 9.0,
+			"wind_degree": 90, "wind_dir": "E", "pressure_mb": 1012.0, "feelslike_c": 26.0, "feelslike_f": 78.8,
+			"uv": 6.0, "last_updated_epoch": 1719838800, "condition": {"text": %q, "icon": "//cdn/113.png"}}}`, condition)
+	}))
+	return cepMock, weatherMock
+}
+
 func TestHandler(t *testing.T) {
 	tracer := otel.Tracer("microservice-tracer-mock")
 
+	cepMock, weatherMock := newUpstreamMocks()
+	defer cepMock.Close()
+	defer weatherMock.Close()
+
 	serviceData := &ServiceData{
 		RequestNameOTEL: "microservice-tracer-mock",
 		OTELTracer:      tracer,
-		CepURL:          "http://viacep.com.br/ws/%s/json/",
-		WeatherURL:      "http://api.weatherapi.com/v1/current.json?key=602ac96551be4db2b0112256243006&q=%s&aqi=no",
+		CepProvider: provider.NewCepChain(tracer, time.Second,
+			provider.NewViaCep(cepMock.URL+"/ws/%s/json/", nil),
+		),
+		WeatherProvider: provider.NewWeatherChain(tracer, time.Second,
+			provider.NewWeatherAPI(weatherMock.URL+"/v1/current.json?q=%s&aqi=no", nil),
+		),
 	}
 
 	server := NewServer(serviceData)
@@ -38,9 +94,13 @@ func TestHandler(t *testing.T) {
 
 	var resp struct {
 		City   string  `json:"city"`
+		State  string  `json:"state"`
 		Temp_c float64 `json:"temp_C"`
 		Temp_f float64 `json:"temp_F"`
 		Temp_k float64 `json:"temp_K"`
+
+		CepProvider     string `json:"cep_provider"`
+		WeatherProvider string `json:"weather_provider"`
 	}
 	err = json.Unmarshal(w.Body.Bytes(), &resp)
 	if err != nil {
@@ -50,16 +110,39 @@ func TestHandler(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.NotEmpty(t, resp)
 	assert.Equal(t, "Guarulhos", resp.City)
+	assert.Equal(t, "SP", resp.State)
+	assert.Equal(t, 25.0, resp.Temp_c)
+	assert.Equal(t, 77.0, resp.Temp_f)
+	assert.Equal(t, 298.0, resp.Temp_k)
+	assert.Equal(t, "viacep", resp.CepProvider)
+	assert.Equal(t, "weatherapi", resp.WeatherProvider)
+}
+
+func TestWeatherResponseKeys(t *testing.T) {
+	body, err := json.Marshal(WeatherResponse{City: "Guarulhos", Temp_c: 25.0, Temp_f: 77.0, Temp_k: 298.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as chaves documentadas, não os nomes dos campos (Temp_c...) que as tags malformadas deixavam sair
+	assert.JSONEq(t, `{"city": "Guarulhos", "temp_C": 25.0, "temp_F": 77.0, "temp_K": 298.0}`, string(body))
 }
 
 func TestHandlerZipCodeNotFound(t *testing.T) {
 	tracer := otel.Tracer("microservice-tracer-mock")
 
+	cepMock, weatherMock := newUpstreamMocks()
+	defer cepMock.Close()
+	defer weatherMock.Close()
+
 	serviceData := &ServiceData{
 		RequestNameOTEL: "microservice-tracer-mock",
 		OTELTracer:      tracer,
-		CepURL:          "http://viacep.com.br/ws/%s/json/",
-		WeatherURL:      "http://api.weatherapi.com/v1/current.json?key=602ac96551be4db2b0112256243006&q=%s&aqi=no",
+		CepProvider: provider.NewCepChain(tracer, time.Second,
+			provider.NewViaCep(cepMock.URL+"/ws/%s/json/", nil),
+		),
+		WeatherProvider: provider.NewWeatherChain(tracer, time.Second,
+			provider.NewWeatherAPI(weatherMock.URL+"/v1/current.json?q=%s&aqi=no", nil),
+		),
 	}
 
 	server := NewServer(serviceData)
@@ -90,4 +173,498 @@ func TestHandlerZipCodeNotFound(t *testing.T) {
 
 	assert.Equal(t, http.StatusNotFound, w.Code)
 	assert.Empty(t, resp)
+
+	var p problem.Problem
+	json.Unmarshal(w.Body.Bytes(), &p)
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusNotFound, p.Status)
+	assert.Equal(t, problem.CodeZipcodeNotFound, p.Code)
+	assert.Equal(t, "can not find zip code", p.Detail)
+}
+
+func TestHandlerServesStaleWeather(t *testing.T) {
+	tracer := otel.Tracer("microservice-tracer-mock")
+
+	cepMock, weatherMock := newUpstreamMocks()
+	defer cepMock.Close()
+	defer weatherMock.Close()
+
+	weatherProvider := provider.NewCachedWeather(
+		provider.NewWeatherChain(tracer, time.Second,
+			provider.NewWeatherAPI(weatherMock.URL+"/v1/current.json?q=%s&aqi=no", nil),
+		),
+		cache.NewMemory(10), 0, time.Hour,
+	)
+	serviceData := &ServiceData{
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      tracer,
+		CepProvider: provider.NewCepChain(tracer, time.Second,
+			provider.NewViaCep(cepMock.URL+"/ws/%s/json/", nil),
+		),
+		WeatherProvider: weatherProvider,
+	}
+
+	server := NewServer(serviceData)
+	router := server.CreateServer()
+
+	for i, warning := range [][]string{nil, {`110 - "Response is Stale"`}} {
+		reqBody, _ := json.Marshal(map[string]string{"cep": "07096240"})
+		req, _ := http.NewRequest("POST", "/", bytes.NewBuffer(reqBody))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, i)
+		assert.Equal(t, warning, w.Header().Values("Warning"), i)
+	}
+}
+
+func TestHandlerBreakerOpen(t *testing.T) {
+	tracer := otel.Tracer("microservice-tracer-mock")
+
+	cepMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer cepMock.Close()
+
+	b, err := breaker.New(provider.ViaCepName, breaker.Settings{FailureThreshold: 1}, otel.Meter("microservice-meter-mock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceData := &ServiceData{
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      tracer,
+		CepProvider: provider.NewCepChain(tracer, time.Second,
+			provider.NewBreakerCep(provider.NewViaCep(cepMock.URL+"/ws/%s/json/", nil), b),
+		),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	// a primeira falha abre o breaker, a segunda chamada nem chega no viacep
+	for _, status := range []int{http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(`{"cep": "07096240"}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, status, w.Code)
+	}
+}
+
+func TestHandlerRateLimited(t *testing.T) {
+	tracer := otel.Tracer("microservice-tracer-mock")
+
+	cepMock, weatherMock := newUpstreamMocks()
+	defer cepMock.Close()
+	defer weatherMock.Close()
+
+	serviceData := &ServiceData{
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      tracer,
+		CepProvider: provider.NewCepChain(tracer, time.Second,
+			provider.NewViaCep(cepMock.URL+"/ws/%s/json/", nil),
+		),
+		WeatherProvider: provider.NewWeatherChain(tracer, time.Second,
+			provider.NewLimitedWeather(
+				provider.NewWeatherAPI(weatherMock.URL+"/v1/current.json?q=%s&aqi=no", nil),
+				provider.NewLimiter(provider.WeatherAPIName, 1, 1, 0),
+			),
+		),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	for _, status := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(`{"cep": "07096240"}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, status, w.Code)
+	}
+}
+
+func TestHandlerExtendedFields(t *testing.T) {
+	tracer := otel.Tracer("microservice-tracer-mock")
+
+	cepMock, weatherMock := newUpstreamMocks()
+	defer cepMock.Close()
+	defer weatherMock.Close()
+
+	serviceData := &ServiceData{
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      tracer,
+		CepProvider: provider.NewCepChain(tracer, time.Second,
+			provider.NewViaCep(cepMock.URL+"/ws/%s/json/", nil),
+		),
+		WeatherProvider: provider.NewWeatherChain(tracer, time.Second,
+			provider.NewWeatherAPI(weatherMock.URL+"/v1/current.json?q=%s&aqi=no", nil),
+		),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	post := func(query string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest("POST", "/"+query, bytes.NewBufferString(`{"cep": "07096240"}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var body map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	// sem pedir campos, a resposta mantém o formato de sempre
+	status, body := post("")
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotContains(t, body, "humidity")
+	assert.NotContains(t, body, "condition")
+
+	status, body = post("?fields=humidity,wind")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 60.0, body["humidity"])
+	assert.Equal(t, 9.0, body["wind_kph"])
+	assert.Equal(t, 90.0, body["wind_degree"])
+	assert.Equal(t, "E", body["wind_dir"])
+	assert.NotContains(t, body, "uv")
+
+	status, body = post("?detail=full")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 1012.0, body["pressure_mb"])
+	assert.Equal(t, map[string]interface{}{"text": "Sunny", "icon": "https://cdn/113.png"}, body["condition"])
+	assert.Equal(t, 26.0, body["feelslike_C"])
+	assert.Equal(t, 78.8, body["feelslike_F"])
+	assert.Equal(t, 299.0, body["feelslike_K"])
+	assert.Equal(t, 6.0, body["uv"])
+	assert.Equal(t, "2024-07-01T13:00:00Z", body["last_updated"])
+
+	status, body = post("?fields=humidity,bogus")
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, problem.CodeInvalidFields, body["code"])
+}
+
+func TestHandlerAcceptLanguage(t *testing.T) {
+	tracer := otel.Tracer("microservice-tracer-mock")
+
+	cepMock, weatherMock := newUpstreamMocks()
+	defer cepMock.Close()
+	defer weatherMock.Close()
+
+	serviceData := &ServiceData{
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      tracer,
+		CepProvider: provider.NewCepChain(tracer, time.Second,
+			provider.NewViaCep(cepMock.URL+"/ws/%s/json/", nil),
+		),
+		WeatherProvider: provider.NewCachedWeather(
+			provider.NewWeatherChain(tracer, time.Second,
+				provider.NewWeatherAPI(weatherMock.URL+"/v1/current.json?q=%s&aqi=no", nil),
+			),
+			cache.NewMemory(10), time.Minute, time.Hour,
+		),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	post := func(cep, language string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/?fields=condition", bytes.NewBufferString(`{"cep": "`+cep+`"}`))
+		req.Header.Set("Accept-Language", language)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("00000000", "pt-BR,pt;q=0.9,en;q=0.8")
+	var p problem.Problem
+	json.Unmarshal(w.Body.Bytes(), &p)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "pt-BR", w.Header().Get("Content-Language"))
+	assert.Equal(t, problem.CodeZipcodeNotFound, p.Code)
+	assert.Equal(t, "não foi possível encontrar o cep", p.Detail)
+
+	// o texto da condição vem no idioma pedido, mesmo com o inglês já em cache
+	var body map[string]interface{}
+	w = post("07096240", "en")
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, "en", w.Header().Get("Content-Language"))
+	assert.Equal(t, "Sunny", body["condition"].(map[string]interface{})["text"])
+
+	w = post("07096240", "pt")
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, "pt-BR", w.Header().Get("Content-Language"))
+	assert.Equal(t, "Sol", body["condition"].(map[string]interface{})["text"])
+
+	// idiomas sem catálogo ficam no padrão
+	w = post("00000000", "fr-FR")
+	json.Unmarshal(w.Body.Bytes(), &p)
+	assert.Equal(t, "en", w.Header().Get("Content-Language"))
+	assert.Equal(t, "can not find zip code", p.Detail)
+}
+
+func TestHandlerSpanStatus(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("microservice-tracer-mock")
+
+	cepMock, _ := newUpstreamMocks()
+	defer cepMock.Close()
+	weatherMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer weatherMock.Close()
+
+	serviceData := &ServiceData{
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      tracer,
+		CepProvider: provider.NewCepChain(tracer, time.Second,
+			provider.NewViaCep(cepMock.URL+"/ws/%s/json/", nil),
+		),
+		WeatherProvider: provider.NewWeatherChain(tracer, time.Second,
+			provider.NewWeatherAPI(weatherMock.URL+"/v1/current.json?q=%s&aqi=no", nil),
+		),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	spansOf := func(cep string, status int) map[string]sdktrace.ReadOnlySpan {
+		started, ended := len(recorder.Started()), len(recorder.Ended())
+		req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(`{"cep": "`+cep+`"}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, status, w.Code)
+
+		// todo span iniciado é encerrado, qualquer que seja o caminho
+		assert.Equal(t, len(recorder.Started())-started, len(recorder.Ended())-ended)
+		spans := map[string]sdktrace.ReadOnlySpan{}
+		for _, span := range recorder.Ended()[ended:] {
+			if span.SpanKind() != trace.SpanKindClient {
+				spans[span.Name()] = span
+			}
+		}
+		return spans
+	}
+
+	// cep inexistente é uma resposta, não uma falha
+	spans := spansOf("00000000", http.StatusNotFound)
+	request := spans["Chamada externamicroservice-tracer-mock"]
+	assert.Equal(t, trace.SpanKindServer, request.SpanKind())
+	assert.Equal(t, codes.Unset, request.Status().Code)
+	assert.Contains(t, request.Attributes(), attribute.Int("http.response.status_code", http.StatusNotFound))
+	assert.Equal(t, codes.Unset, spans["getCEP"].Status().Code)
+	assert.Contains(t, spans["getCEP"].Attributes(), attribute.String("error.type", "not_found"))
+	assert.Equal(t, "exception", spans["getCEP"].Events()[0].Name)
+
+	spans = spansOf("07096240", http.StatusInternalServerError)
+	request = spans["Chamada externamicroservice-tracer-mock"]
+	assert.Equal(t, codes.Error, request.Status().Code)
+	assert.Contains(t, request.Attributes(), attribute.Int("http.response.status_code", http.StatusInternalServerError))
+	assert.Equal(t, codes.Unset, spans["getCEP"].Status().Code)
+	for _, name := range []string{"getWeather", "provider weatherapi"} {
+		assert.Equal(t, codes.Error, spans[name].Status().Code, name)
+		assert.Contains(t, spans[name].Attributes(), attribute.String("error.type", "500"), name)
+	}
+}
+
+func TestHandlerSpanAttributes(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("microservice-tracer-mock")
+
+	cepMock, weatherMock := newUpstreamMocks()
+	defer cepMock.Close()
+	defer weatherMock.Close()
+
+	serviceData := &ServiceData{
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      tracer,
+		CepProvider: provider.NewCachedCep(
+			provider.NewCepChain(tracer, time.Second, provider.NewViaCep(cepMock.URL+"/ws/%s/json/", nil)),
+			cache.NewMemory(10), time.Hour, time.Minute,
+		),
+		WeatherProvider: provider.NewCachedWeather(
+			provider.NewWeatherChain(tracer, time.Second,
+				provider.NewWeatherAPI(weatherMock.URL+"/v1/current.json?q=%s&aqi=no", nil),
+			),
+			cache.NewMemory(10), time.Minute, time.Hour,
+		),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	requestSpan := func(body string) sdktrace.ReadOnlySpan {
+		req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(body))
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		spans := recorder.Ended()
+		return spans[len(spans)-1]
+	}
+
+	for _, cacheStatus := range []string{"miss", "hit"} {
+		span := requestSpan(`{"cep": "07096240"}`)
+		assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+		for _, kv := range []attribute.KeyValue{
+			attribute.String("cep", "07096240"),
+			attribute.String("address.localidade", "Guarulhos"),
+			attribute.String("address.uf", "SP"),
+			attribute.String("cep.provider", "viacep"),
+			attribute.String("cep.cache.status", cacheStatus),
+			attribute.String("weather.provider", "weatherapi"),
+			attribute.String("weather.cache.status", cacheStatus),
+			attribute.Float64("weather.temp_c", 25.0),
+			attribute.Float64("weather.temp_f", 77.0),
+			attribute.Float64("weather.temp_k", 298.0),
+		} {
+			assert.Contains(t, span.Attributes(), kv, cacheStatus)
+		}
+	}
+
+	// com a chave configurada o cep vai para o span como hash
+	serviceData.CepHashKey = []byte("chave")
+	span := requestSpan(`{"cep": "07096240"}`)
+	assert.NotContains(t, span.Attributes(), attribute.String("cep", "07096240"))
+
+	span = requestSpan(`{"cep": 7096240}`)
+	assert.Len(t, span.Events(), 1)
+	assert.Equal(t, "validation failed", span.Events()[0].Name)
+	assert.Contains(t, span.Events()[0].Attributes, attribute.String("validation.field", "cep"))
+	assert.Contains(t, span.Events()[0].Attributes, attribute.String("problem.code", problem.CodeInvalidZipcode))
+}
+
+func TestHandlerMetrics(t *testing.T) {
+	tracer := otel.Tracer("microservice-tracer-mock")
+	reader := sdkmetric.NewManualReader()
+	measurements, err := metrics.New(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("microservice-meter-mock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cepMock, weatherMock := newUpstreamMocks()
+	defer cepMock.Close()
+	defer weatherMock.Close()
+
+	weatherChain := provider.NewWeatherChain(tracer, time.Second,
+		provider.NewWeatherAPI(weatherMock.URL+"/v1/current.json?q=%s&aqi=no", nil),
+	)
+	weatherChain.Metrics = measurements
+	serviceData := &ServiceData{
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      tracer,
+		CepProvider: provider.NewCepChain(tracer, time.Second,
+			provider.NewViaCep(cepMock.URL+"/ws/%s/json/", nil),
+		),
+		WeatherProvider: provider.NewCachedWeather(weatherChain, cache.NewMemory(10), time.Minute, time.Hour),
+		Metrics:         measurements,
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	for _, body := range []string{`{"cep": "07096240"}`, `{"cep": "07096240"}`, `{"cep": "00000000"}`, `{"cep": 1}`} {
+		req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(body))
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int64{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		switch data := m.Data.(type) {
+		case metricdata.Sum[int64]:
+			for _, p := range data.DataPoints {
+				counts[m.Name+" "+p.Attributes.Encoded(attribute.DefaultEncoder())] = p.Value
+			}
+		case metricdata.Histogram[float64]:
+			for _, p := range data.DataPoints {
+				counts[m.Name+" "+p.Attributes.Encoded(attribute.DefaultEncoder())] = int64(p.Count)
+			}
+		}
+	}
+	assert.Equal(t, map[string]int64{
+		"cep.lookups outcome=found":                                                                        2,
+		"cep.lookups outcome=not_found":                                                                    1,
+		"cep.lookups outcome=invalid":                                                                      1,
+		"cache.requests cache.name=weather,cache.status=miss":                                              1,
+		"cache.requests cache.name=weather,cache.status=hit":                                               1,
+		"upstream.request.duration outcome=success,upstream.name=weatherapi":                               1,
+		"http.server.request.duration http.request.method=POST,http.response.status_code=200,http.route=/": 2,
+		"http.server.request.duration http.request.method=POST,http.response.status_code=404,http.route=/": 1,
+		"http.server.request.duration http.request.method=POST,http.response.status_code=422,http.route=/": 1,
+	}, counts)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	metricsHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "cep_lookups_total 1")
+	})
+
+	// sem handler, ou com /metrics na porta de administração, a rota não existe
+	for _, test := range []struct {
+		handler http.Handler
+		status  int
+	}{
+		{nil, http.StatusNotFound},
+		{metricsHandler, http.StatusOK},
+	} {
+		router := NewServer(&ServiceData{MetricsHandler: test.handler}).CreateServer()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.Equal(t, test.status, w.Code)
+	}
+}
+
+func TestHandlerBreakerOpenWithOtherFailure(t *testing.T) {
+	tracer := otel.Tracer("microservice-tracer-mock")
+
+	cepMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer cepMock.Close()
+
+	b, err := breaker.New(provider.ViaCepName, breaker.Settings{FailureThreshold: 1}, otel.Meter("microservice-meter-mock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceData := &ServiceData{
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      tracer,
+		CepProvider: provider.NewCepChain(tracer, time.Second,
+			provider.NewBreakerCep(provider.NewViaCep(cepMock.URL+"/ws/%s/json/", nil), b),
+			provider.NewBrasilAPI(cepMock.URL+"/api/cep/v1/%s", nil),
+		),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	// com o breaker do viacep aberto o brasilapi ainda falhou de verdade: não é
+	// indisponibilidade, é erro
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(`{"cep": "07096240"}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var p problem.Problem
+		json.Unmarshal(w.Body.Bytes(), &p)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, problem.CodeInternal, p.Code)
+	}
+}
+
+func TestHandlerRejectsMalformedCep(t *testing.T) {
+	tracer := otel.Tracer("microservice-tracer-mock")
+
+	cepMock, weatherMock := newUpstreamMocks()
+	defer cepMock.Close()
+	defer weatherMock.Close()
+
+	serviceData := &ServiceData{
+		RequestNameOTEL: "microservice-tracer-mock",
+		OTELTracer:      tracer,
+		CepProvider: provider.NewCachedCep(
+			provider.NewCepChain(tracer, time.Second, provider.NewViaCep(cepMock.URL+"/ws/%s/json/", nil)),
+			cache.NewMemory(10), time.Hour, time.Minute,
+		),
+		WeatherProvider: provider.NewWeatherChain(tracer, time.Second,
+			provider.NewWeatherAPI(weatherMock.URL+"/v1/current.json?q=%s&aqi=no", nil),
+		),
+	}
+	router := NewServer(serviceData).CreateServer()
+
+	// o mesmo CEP com lixo em volta é recusado, esteja ou não no cache
+	for _, body := range []string{`{"cep": "07096240"}`, `{"cep": "abc07096240"}`, `{"cep": "07096240/../x"}`} {
+		req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if body == `{"cep": "07096240"}` {
+			assert.Equal(t, http.StatusOK, w.Code)
+			continue
+		}
+		var p problem.Problem
+		json.Unmarshal(w.Body.Bytes(), &p)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, body)
+		assert.Equal(t, problem.CodeInvalidZipcode, p.Code, body)
+	}
 }